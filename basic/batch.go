@@ -0,0 +1,36 @@
+package basic
+
+import "sync"
+
+// maxPooledBatch 放回池中的批次缓冲容量上限, 超过的交给 GC 回收, 偶尔的大批次不会一直占用内存
+const maxPooledBatch = 1 << 16
+
+// Batch 批次缓冲, 从 BatchPool 取得
+type Batch[ITEM any] struct {
+	Items []ITEM
+}
+
+// BatchPool 批次缓冲池. 每个批次从池中取得自己的缓冲, 执行完后放回, 执行中的批次不会被之后的批次覆盖.
+// 执行函数返回后不能再使用批次的数据. 零值可用
+type BatchPool[ITEM any] struct {
+	pool sync.Pool
+}
+
+// Get 取得一个空的批次缓冲
+func (p *BatchPool[ITEM]) Get() *Batch[ITEM] {
+	if b, ok := p.pool.Get().(*Batch[ITEM]); ok {
+		return b
+	}
+	return &Batch[ITEM]{}
+}
+
+// Put 批次执行完后放回缓冲, err 为执行的结果. 执行超时后被放弃的执行函数可能还在使用数据, 这时不放回
+func (p *BatchPool[ITEM]) Put(m *Monitor, b *Batch[ITEM], err error) {
+	if m.Abandoned(err) || cap(b.Items) > maxPooledBatch {
+		return
+	}
+	// 不再引用数据, 数据可以被 GC 回收
+	clear(b.Items)
+	b.Items = b.Items[:0]
+	p.pool.Put(b)
+}
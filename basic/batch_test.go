@@ -0,0 +1,66 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestBatchPool(t *testing.T) {
+	m := &Monitor{}
+
+	var p BatchPool[*int]
+	b := p.Get()
+	for i := 0; i < 4; i++ {
+		b.Items = append(b.Items, new(int))
+	}
+	items := b.Items
+	p.Put(m, b, nil)
+	for i, item := range items {
+		if item != nil {
+			t.Fatalf("放回后第 %d 个数据期望被清除", i)
+		}
+	}
+	if len(b.Items) != 0 {
+		t.Errorf("放回后期望为空, 实际 %d", len(b.Items))
+	}
+
+	// 超时被放弃的执行函数可能还在使用数据, 不能清除
+	b = p.Get()
+	b.Items = append(b.Items, new(int))
+	items = b.Items
+	p.Put(m, b, fmt.Errorf("batch: %w", ErrHandlerTimeout))
+	if items[0] == nil {
+		t.Error("放弃的批次不能被清除")
+	}
+
+	m.SetAbandonPolicy(AbandonWait)
+	if m.Abandoned(ErrHandlerTimeout) {
+		t.Error("AbandonWait 等待执行函数返回, 不是放弃")
+	}
+	if m.Abandoned(context.Canceled) {
+		t.Error("其他错误不是放弃")
+	}
+}
+
+func BenchmarkBatchPool(b *testing.B) {
+	entries := make([]Entry[int], 256)
+	m := &Monitor{}
+
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			items := ItemsOf(entries, nil)
+			_ = items
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		var p BatchPool[int]
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			batch := p.Get()
+			batch.Items = ItemsOf(entries, batch.Items)
+			p.Put(m, batch, nil)
+		}
+	})
+}
@@ -0,0 +1,338 @@
+package basic
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrBreakerOpen 熔断打开, 批次转入死信
+var ErrBreakerOpen = errors.New("circuit breaker open")
+
+// BreakerState 熔断器状态
+type BreakerState int32
+
+const (
+	// BreakerClosed 闭合, 正常放行
+	BreakerClosed BreakerState = iota
+	// BreakerOpen 打开, 拒绝执行
+	BreakerOpen
+	// BreakerHalfOpen 半开, 只放行一个探测批次
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// BreakerPolicy 熔断打开时, 执行器对数据的处理策略
+type BreakerPolicy int32
+
+const (
+	// BreakerBuffer 暂停消费, 数据保留在缓冲中直到熔断恢复
+	BreakerBuffer BreakerPolicy = iota
+	// BreakerDeadLetter 继续消费, 数据交给死信函数处理
+	BreakerDeadLetter
+)
+
+// halfOpenPollInterval 半开状态下探测批次未结束时的等待间隔
+const halfOpenPollInterval = time.Millisecond * 10
+
+// BreakerConfig 熔断配置. FailureRatio 和 ConsecutiveFailures 任意一个满足即熔断
+type BreakerConfig struct {
+	FailureRatio        float64       // 失败比例阈值 (0, 1], 0 不启用
+	MinRequests         uint32        // 计算失败比例所需的最少批次数
+	ConsecutiveFailures uint32        // 连续失败次数阈值, 0 不启用
+	Interval            time.Duration // 闭合状态下统计的清零周期, 0 不清零
+	OpenTimeout         time.Duration // 打开后多久进入半开, 默认 5s
+
+	// 状态变化回调, 不在锁内调用
+	OnStateChange func(from, to BreakerState)
+}
+
+// CircuitBreaker 以批次为单位统计成功失败的熔断器
+type CircuitBreaker struct {
+	cfg BreakerConfig
+
+	mu          sync.Mutex
+	state       BreakerState
+	requests    uint32
+	failures    uint32
+	consecutive uint32
+	expiry      time.Time // 闭合: 统计清零时间; 打开: 进入半开的时间
+	probing     bool      // 半开状态下探测批次是否在执行
+}
+
+func NewCircuitBreaker(cfg BreakerConfig) *CircuitBreaker {
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = time.Second * 5
+	}
+	cb := &CircuitBreaker{cfg: cfg}
+	cb.resetCounts(time.Now())
+	return cb
+}
+
+// State 返回当前状态
+func (cb *CircuitBreaker) State() BreakerState {
+	cb.mu.Lock()
+	notify := cb.refresh(time.Now())
+	state := cb.state
+	cb.mu.Unlock()
+
+	notify()
+	return state
+}
+
+// Allow 是否允许执行一个批次. 半开状态下只允许一个探测批次
+func (cb *CircuitBreaker) Allow() bool {
+	ok, _ := cb.allow()
+	return ok
+}
+
+// Wait 阻塞直到允许执行一个批次. stop 关闭时返回 false
+func (cb *CircuitBreaker) Wait(stop <-chan struct{}) bool {
+	for {
+		ok, retry := cb.allow()
+		if ok {
+			return true
+		}
+
+		timer := time.NewTimer(retry)
+		select {
+		case <-stop:
+			timer.Stop()
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// Done 根据批次执行结果记录成功或失败
+func (cb *CircuitBreaker) Done(err error) {
+	if err != nil {
+		cb.Failure()
+	} else {
+		cb.Success()
+	}
+}
+
+// Release 放弃 Allow 或 Wait 放行的批次, 不记录结果. 半开状态下释放探测名额, 下一个批次可以探测
+func (cb *CircuitBreaker) Release() {
+	cb.mu.Lock()
+	if cb.state == BreakerHalfOpen {
+		cb.probing = false
+	}
+	cb.mu.Unlock()
+}
+
+// Success 记录一次成功的批次
+func (cb *CircuitBreaker) Success() {
+	cb.mu.Lock()
+	now := time.Now()
+	notify := cb.refresh(now)
+
+	switch cb.state {
+	case BreakerClosed:
+		cb.requests++
+		cb.consecutive = 0
+	case BreakerHalfOpen:
+		notify = chainNotify(notify, cb.setState(BreakerClosed, now))
+	}
+	cb.mu.Unlock()
+
+	notify()
+}
+
+// Failure 记录一次失败的批次
+func (cb *CircuitBreaker) Failure() {
+	cb.mu.Lock()
+	now := time.Now()
+	notify := cb.refresh(now)
+
+	switch cb.state {
+	case BreakerClosed:
+		cb.requests++
+		cb.failures++
+		cb.consecutive++
+		if cb.shouldTrip() {
+			notify = chainNotify(notify, cb.setState(BreakerOpen, now))
+		}
+	case BreakerHalfOpen:
+		notify = chainNotify(notify, cb.setState(BreakerOpen, now))
+	}
+	cb.mu.Unlock()
+
+	notify()
+}
+
+func (cb *CircuitBreaker) allow() (bool, time.Duration) {
+	cb.mu.Lock()
+	now := time.Now()
+	notify := cb.refresh(now)
+
+	var ok bool
+	var retry time.Duration
+	switch cb.state {
+	case BreakerClosed:
+		ok = true
+	case BreakerOpen:
+		retry = cb.expiry.Sub(now)
+	case BreakerHalfOpen:
+		if !cb.probing {
+			cb.probing = true
+			ok = true
+		} else {
+			retry = halfOpenPollInterval
+		}
+	}
+	cb.mu.Unlock()
+
+	notify()
+	return ok, retry
+}
+
+func (cb *CircuitBreaker) shouldTrip() bool {
+	if cb.cfg.ConsecutiveFailures > 0 && cb.consecutive >= cb.cfg.ConsecutiveFailures {
+		return true
+	}
+	if cb.cfg.FailureRatio > 0 && cb.requests >= cb.cfg.MinRequests && cb.requests > 0 {
+		return float64(cb.failures)/float64(cb.requests) >= cb.cfg.FailureRatio
+	}
+	return false
+}
+
+// refresh 处理时间驱动的状态变化, 必须在锁内调用
+func (cb *CircuitBreaker) refresh(now time.Time) func() {
+	switch cb.state {
+	case BreakerClosed:
+		if !cb.expiry.IsZero() && now.After(cb.expiry) {
+			cb.resetCounts(now)
+		}
+	case BreakerOpen:
+		if !now.Before(cb.expiry) {
+			return cb.setState(BreakerHalfOpen, now)
+		}
+	}
+	return func() {}
+}
+
+// setState 必须在锁内调用, 返回的函数在解锁后调用以触发回调
+func (cb *CircuitBreaker) setState(state BreakerState, now time.Time) func() {
+	from := cb.state
+	if from == state {
+		return func() {}
+	}
+
+	cb.state = state
+	cb.probing = false
+	cb.resetCounts(now)
+	if state == BreakerOpen {
+		cb.expiry = now.Add(cb.cfg.OpenTimeout)
+	}
+
+	onStateChange := cb.cfg.OnStateChange
+	if onStateChange == nil {
+		return func() {}
+	}
+	return func() { onStateChange(from, state) }
+}
+
+func (cb *CircuitBreaker) resetCounts(now time.Time) {
+	cb.requests = 0
+	cb.failures = 0
+	cb.consecutive = 0
+	cb.expiry = time.Time{}
+	if cb.state == BreakerClosed && cb.cfg.Interval > 0 {
+		cb.expiry = now.Add(cb.cfg.Interval)
+	}
+}
+
+func chainNotify(a, b func()) func() {
+	return func() {
+		a()
+		b()
+	}
+}
+
+// BreakerGuard 把熔断器接入执行器的批次处理, 零值表示不熔断
+type BreakerGuard[ITEM any] struct {
+	mu           sync.Mutex
+	breaker      *CircuitBreaker
+	policy       BreakerPolicy
+	deadLetterDo func(items []ITEM)
+}
+
+// SetBreaker 设置熔断器及打开时的处理策略, cb 为 nil 时关闭熔断
+func (g *BreakerGuard[ITEM]) SetBreaker(cb *CircuitBreaker, policy BreakerPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.breaker = cb
+	g.policy = policy
+}
+
+// SetDeadLetter 设置 BreakerDeadLetter 策略下的死信处理函数. 函数收到数据的副本, 可以保留
+func (g *BreakerGuard[ITEM]) SetDeadLetter(deadLetterDo func(items []ITEM)) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.deadLetterDo = deadLetterDo
+}
+
+// Acquire 申请执行批次. err 不为 nil 时批次不能执行: 已转入死信返回 ErrBreakerOpen,
+// 收到停止信号返回 ErrClosed. err 为 nil 时执行完毕必须调用 release 上报结果.
+// 批次因关闭没有执行 (暂停或限速等待中关闭, 返回 ErrClosed) 时 release 不记录结果, 只释放探测名额
+// 死信处理函数的 panic 记录到 m
+func (g *BreakerGuard[ITEM]) Acquire(m *Monitor, stop <-chan struct{}, items []ITEM) (release func(err error), err error) {
+	g.mu.Lock()
+	cb := g.breaker
+	policy := g.policy
+	deadLetterDo := g.deadLetterDo
+	g.mu.Unlock()
+
+	if cb == nil {
+		return func(error) {}, nil
+	}
+
+	switch policy {
+	case BreakerDeadLetter:
+		if !cb.Allow() {
+			if deadLetterDo != nil {
+				// 批次的缓冲之后会放回复用, 死信处理函数使用副本
+				callDeadLetter(m, deadLetterDo, append([]ITEM(nil), items...))
+			}
+			return nil, ErrBreakerOpen
+		}
+	default:
+		if !cb.Wait(stop) {
+			return nil, ErrClosed
+		}
+	}
+
+	return func(err error) {
+		if errors.Is(err, ErrClosed) {
+			cb.Release()
+			return
+		}
+		cb.Done(err)
+	}, nil
+}
+
+func callDeadLetter[ITEM any](m *Monitor, deadLetterDo func(items []ITEM), items []ITEM) {
+	// recover保护
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			m.Recovered("DeadLetter", ierr)
+		}
+	}()
+	deadLetterDo(items)
+}
@@ -0,0 +1,175 @@
+package basic
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBreakerConsecutiveFailures(t *testing.T) {
+	var mu sync.Mutex
+	var changes []BreakerState
+
+	cb := NewCircuitBreaker(BreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Millisecond * 50,
+		OnStateChange: func(from, to BreakerState) {
+			mu.Lock()
+			defer mu.Unlock()
+			changes = append(changes, to)
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		if !cb.Allow() {
+			t.Fatalf("第 %d 次应该放行", i)
+		}
+		cb.Done(errors.New("down"))
+	}
+
+	if cb.State() != BreakerOpen {
+		t.Fatalf("连续失败后应该打开, 实际 %s", cb.State())
+	}
+	if cb.Allow() {
+		t.Error("打开状态不应该放行")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if !cb.Allow() {
+		t.Fatal("半开状态应该放行一个探测批次")
+	}
+	if cb.Allow() {
+		t.Error("半开状态只允许一个探测批次")
+	}
+	cb.Done(nil)
+
+	if cb.State() != BreakerClosed {
+		t.Errorf("探测成功后应该闭合, 实际 %s", cb.State())
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := []BreakerState{BreakerOpen, BreakerHalfOpen, BreakerClosed}
+	if len(changes) != len(expected) {
+		t.Fatalf("期望状态变化 %v, 实际 %v", expected, changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("期望状态变化 %v, 实际 %v", expected, changes)
+		}
+	}
+}
+
+func TestBreakerFailureRatio(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{
+		FailureRatio: 0.5,
+		MinRequests:  4,
+		OpenTimeout:  time.Millisecond * 20,
+	})
+
+	cb.Success()
+	cb.Failure()
+	cb.Success()
+	if cb.State() != BreakerClosed {
+		t.Fatal("未达到最少批次数不应该熔断")
+	}
+	cb.Failure()
+	if cb.State() != BreakerOpen {
+		t.Fatalf("失败比例达到阈值应该熔断, 实际 %s", cb.State())
+	}
+
+	time.Sleep(time.Millisecond * 30)
+	if !cb.Allow() {
+		t.Fatal("半开状态应该放行一个探测批次")
+	}
+	cb.Failure()
+	if cb.State() != BreakerOpen {
+		t.Errorf("探测失败应该重新打开, 实际 %s", cb.State())
+	}
+}
+
+func TestBreakerGuardWait(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Hour})
+	cb.Failure()
+
+	var g BreakerGuard[int]
+	g.SetBreaker(cb, BreakerBuffer)
+
+	stop := make(chan struct{})
+	go func() {
+		time.Sleep(time.Millisecond * 20)
+		close(stop)
+	}()
+
+	if _, err := g.Acquire(&Monitor{}, stop, []int{1}); err != ErrClosed {
+		t.Error("熔断打开时 Buffer 策略应该等待直到停止")
+	}
+
+	var dead []int
+	g.SetBreaker(cb, BreakerDeadLetter)
+	g.SetDeadLetter(func(items []int) {
+		dead = append(dead, items...)
+	})
+	if _, err := g.Acquire(&Monitor{}, nil, []int{1, 2}); err != ErrBreakerOpen {
+		t.Error("熔断打开时 DeadLetter 策略不应该放行")
+	}
+	if len(dead) != 2 {
+		t.Errorf("期望死信 2 个, 实际 %v", dead)
+	}
+}
+
+func TestBreakerGuardClosed(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Millisecond * 20})
+	cb.Failure()
+	time.Sleep(time.Millisecond * 30)
+
+	var g BreakerGuard[int]
+	g.SetBreaker(cb, BreakerBuffer)
+
+	release, err := g.Acquire(&Monitor{}, nil, []int{1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 探测批次没有执行就关闭, 不记录失败
+	release(ErrClosed)
+	if cb.State() != BreakerHalfOpen {
+		t.Fatalf("没有执行的探测批次不应该打开熔断, 实际 %s", cb.State())
+	}
+	if !cb.Allow() {
+		t.Fatal("探测名额应该被释放")
+	}
+	cb.Done(nil)
+	if cb.State() != BreakerClosed {
+		t.Errorf("探测成功后应该闭合, 实际 %s", cb.State())
+	}
+}
+
+func TestBreakerGuardDeadLetterPanic(t *testing.T) {
+	cb := NewCircuitBreaker(BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Hour})
+	cb.Failure()
+
+	m, buf := newTestMonitor(slog.LevelError)
+	var g BreakerGuard[int]
+	g.SetBreaker(cb, BreakerDeadLetter)
+
+	var kept []int
+	g.SetDeadLetter(func(items []int) {
+		kept = items
+		panic("dead letter down")
+	})
+
+	items := []int{1, 2}
+	if _, err := g.Acquire(m, nil, items); err != ErrBreakerOpen {
+		t.Errorf("期望 ErrBreakerOpen, 实际 %v", err)
+	}
+	// 批次缓冲复用后死信处理函数保留的数据不变
+	items[0] = 100
+	if len(kept) != 2 || kept[0] != 1 {
+		t.Errorf("期望保留数据的副本 [1 2], 实际 %v", kept)
+	}
+	if records := buf.records(t); len(records) != 1 || records[0][LogKeyHook] != "DeadLetter" || records[0][LogKeyPanic] != "dead letter down" {
+		t.Errorf("期望记录死信处理函数的 panic, 实际 %v", records)
+	}
+}
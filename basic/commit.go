@@ -0,0 +1,119 @@
+package basic
+
+import (
+	"context"
+	"sync"
+)
+
+// Committer 按批次开始的顺序调用提交函数. 批次可以并发执行, 先执行完的批次等待前面的批次提交后再提交.
+// 执行失败或被丢弃的批次同样提交, 提交函数收到批次的错误, 只有 err 为 nil 时批次执行成功.
+// 零值可用, 没有设置提交函数时不提交
+type Committer[ITEM any] struct {
+	mu         sync.Mutex
+	onCommitDo func(seq uint64, items []ITEM, err error)
+	next       uint64                     // 最后分配的序号
+	committed  uint64                     // 最后提交的序号
+	done       map[uint64]committed[ITEM] // 执行完等待前面批次提交的批次
+	committing bool                       // 有协程正在按顺序提交
+	idle       chan struct{}              // 有协程等待提交完时创建, 分配的序号全部提交后关闭
+}
+
+// committed 执行完等待提交的批次
+type committed[ITEM any] struct {
+	items []ITEM
+	err   error
+}
+
+// SetOnCommit 设置提交函数, seq 从 1 开始按批次开始的顺序递增, err 为批次的错误. 同一时间只有一个协程调用
+func (c *Committer[ITEM]) SetOnCommit(onCommitDo func(seq uint64, items []ITEM, err error)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.onCommitDo = onCommitDo
+}
+
+// Enabled 是否设置了提交函数. 设置了时批次的数据在提交前还会被使用
+func (c *Committer[ITEM]) Enabled() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.onCommitDo != nil
+}
+
+// Next 为一个批次分配序号, 执行器按批次开始的顺序调用. 分配了序号的批次必须调用 Done
+func (c *Committer[ITEM]) Next() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.next++
+	return c.next
+}
+
+// Done 序号 seq 的批次以 err 结束. 前面的批次都已提交时按顺序提交 seq 和之后已执行完的批次,
+// 否则留给执行完前一个批次的协程提交. 提交函数的 panic 记录到 m
+func (c *Committer[ITEM]) Done(m *Monitor, seq uint64, items []ITEM, err error) {
+	c.mu.Lock()
+	if c.done == nil {
+		c.done = make(map[uint64]committed[ITEM])
+	}
+	c.done[seq] = committed[ITEM]{items: items, err: err}
+	if c.committing {
+		c.mu.Unlock()
+		return
+	}
+
+	c.committing = true
+	for {
+		batch, ok := c.done[c.committed+1]
+		if !ok {
+			break
+		}
+		delete(c.done, c.committed+1)
+		seq, onCommitDo := c.committed+1, c.onCommitDo
+		c.mu.Unlock()
+
+		if onCommitDo != nil {
+			c.callOnCommit(m, onCommitDo, seq, batch)
+		}
+		c.mu.Lock()
+		// 提交函数返回后才算提交完, Wait 返回时提交函数都已调用完
+		c.committed = seq
+	}
+	c.committing = false
+	if c.committed == c.next && c.idle != nil {
+		close(c.idle)
+		c.idle = nil
+	}
+	c.mu.Unlock()
+}
+
+// Wait 等待已分配序号的批次全部提交完. ctx 结束返回 ctx.Err()
+func (c *Committer[ITEM]) Wait(ctx context.Context) error {
+	c.mu.Lock()
+	if c.committed == c.next {
+		c.mu.Unlock()
+		return nil
+	}
+	if c.idle == nil {
+		c.idle = make(chan struct{})
+	}
+	idle := c.idle
+	c.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Committer[ITEM]) callOnCommit(m *Monitor, onCommitDo func(seq uint64, items []ITEM, err error), seq uint64, batch committed[ITEM]) {
+	// recover保护
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			m.Recovered("OnCommit", ierr)
+		}
+	}()
+	onCommitDo(seq, batch.items, batch.err)
+}
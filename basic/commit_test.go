@@ -0,0 +1,109 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/rand"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommitterOrder(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+
+	var c Committer[int]
+	var got []uint64
+	c.SetOnCommit(func(seq uint64, items []int, err error) {
+		if items[0] != int(seq) {
+			t.Errorf("批次 %d 的数据错误 %v", seq, items)
+		}
+		got = append(got, seq)
+	})
+
+	const n = 1000
+	seqs := make([]uint64, n)
+	for i := range seqs {
+		seqs[i] = c.Next()
+	}
+	rand.Shuffle(n, func(i, j int) { seqs[i], seqs[j] = seqs[j], seqs[i] })
+
+	var wg sync.WaitGroup
+	for _, seq := range seqs {
+		wg.Add(1)
+		go func(seq uint64) {
+			defer wg.Done()
+			c.Done(m, seq, []int{int(seq)}, nil)
+		}(seq)
+	}
+	wg.Wait()
+
+	if len(got) != n {
+		t.Fatalf("期望提交 %d 个批次, 实际 %d", n, len(got))
+	}
+	for i, seq := range got {
+		if seq != uint64(i+1) {
+			t.Fatalf("第 %d 个提交的序号 %d", i, seq)
+		}
+	}
+}
+
+func TestCommitterPanic(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelError)
+
+	var c Committer[int]
+	var committed []uint64
+	c.SetOnCommit(func(seq uint64, items []int, err error) {
+		committed = append(committed, seq)
+		if seq == 1 {
+			panic("commit")
+		}
+	})
+
+	first, second := c.Next(), c.Next()
+	c.Done(m, second, nil, nil)
+	if len(committed) != 0 {
+		t.Fatalf("前面的批次没有执行完不能提交 %v", committed)
+	}
+	c.Done(m, first, nil, nil)
+	if len(committed) != 2 {
+		t.Errorf("panic 后期望继续提交, 实际 %v", committed)
+	}
+	if len(buf.records(t)) != 1 {
+		t.Errorf("期望记录 panic, 实际 %v", buf.records(t))
+	}
+}
+
+func TestCommitterWait(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+
+	var c Committer[int]
+	var errs []error
+	c.SetOnCommit(func(seq uint64, items []int, err error) {
+		errs = append(errs, err)
+	})
+
+	if err := c.Wait(context.Background()); err != nil {
+		t.Fatalf("没有批次时期望立即返回, 实际 %v", err)
+	}
+
+	first, second := c.Next(), c.Next()
+	c.Done(m, second, nil, ErrClosed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := c.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("前面的批次没有提交时期望等待, 实际 %v", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() { waited <- c.Wait(context.Background()) }()
+	c.Done(m, first, nil, nil)
+	if err := <-waited; err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 || errs[0] != nil || !errors.Is(errs[1], ErrClosed) {
+		t.Errorf("期望提交函数收到批次的错误, 实际 %v", errs)
+	}
+}
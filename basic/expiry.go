@@ -0,0 +1,103 @@
+package basic
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry 执行器内部传递的数据
+type Entry[ITEM any] struct {
+	Item     ITEM
+	Deadline time.Time       // 过期时间, 零值不过期
+	Ctx      context.Context // 收集时的上下文, 用于链路追踪, 可以为 nil
+}
+
+// ItemsOf 取出 entries 的数据追加到 items 返回
+func ItemsOf[ITEM any](entries []Entry[ITEM], items []ITEM) []ITEM {
+	for _, entry := range entries {
+		items = append(items, entry.Item)
+	}
+	return items
+}
+
+// Expiry 数据过期处理. 零值表示不过期
+type Expiry[ITEM any] struct {
+	ttl     atomic.Int64
+	expired atomic.Uint64
+
+	mu          sync.Mutex
+	onExpiredDo func(item ITEM)
+}
+
+// SetTTL 设置执行器默认的存活时间, 从收集时开始计算. 小于等于0不过期
+func (e *Expiry[ITEM]) SetTTL(ttl time.Duration) {
+	e.ttl.Store(int64(ttl))
+}
+
+// SetOnExpired 设置过期数据的处理函数, 在执行器的循环协程中调用
+func (e *Expiry[ITEM]) SetOnExpired(onExpiredDo func(item ITEM)) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.onExpiredDo = onExpiredDo
+}
+
+// Entry 按默认存活时间包装数据
+func (e *Expiry[ITEM]) Entry(item ITEM) Entry[ITEM] {
+	entry := Entry[ITEM]{Item: item}
+	if ttl := time.Duration(e.ttl.Load()); ttl > 0 {
+		entry.Deadline = time.Now().Add(ttl)
+	}
+	return entry
+}
+
+// EntryWithDeadline 以指定过期时间包装数据, 覆盖默认存活时间
+func (e *Expiry[ITEM]) EntryWithDeadline(item ITEM, deadline time.Time) Entry[ITEM] {
+	return Entry[ITEM]{Item: item, Deadline: deadline}
+}
+
+// Filter 丢弃过期的数据, 未过期的原地保留在 entries 的前部返回. 丢弃的数量记录到 m
+func (e *Expiry[ITEM]) Filter(m *Monitor, entries []Entry[ITEM]) []Entry[ITEM] {
+	var onExpiredDo func(item ITEM)
+	var now time.Time
+
+	live := entries[:0]
+	for _, entry := range entries {
+		if !entry.Deadline.IsZero() {
+			if now.IsZero() {
+				now = time.Now()
+				e.mu.Lock()
+				onExpiredDo = e.onExpiredDo
+				e.mu.Unlock()
+			}
+
+			if !now.Before(entry.Deadline) {
+				e.expired.Add(1)
+				if onExpiredDo != nil {
+					e.callOnExpired(m, onExpiredDo, entry.Item)
+				}
+				continue
+			}
+		}
+		live = append(live, entry)
+	}
+	m.Expired(len(entries) - len(live))
+	return live
+}
+
+// Expired 过期丢弃的数量
+func (e *Expiry[ITEM]) Expired() uint64 {
+	return e.expired.Load()
+}
+
+func (e *Expiry[ITEM]) callOnExpired(m *Monitor, onExpiredDo func(item ITEM), item ITEM) {
+	// recover保护
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			m.Recovered("OnExpired", ierr)
+		}
+	}()
+	onExpiredDo(item)
+}
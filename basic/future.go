@@ -0,0 +1,61 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrClosed 执行器已关闭
+var ErrClosed = errors.New("executor closed")
+
+// Future 单个数据的异步执行结果
+type Future[R any] struct {
+	done chan struct{}
+	once sync.Once
+
+	value R
+	err   error
+}
+
+func NewFuture[R any]() *Future[R] {
+	return &Future[R]{done: make(chan struct{})}
+}
+
+// Resolve 设置结果, 只有第一次调用生效
+func (f *Future[R]) Resolve(value R, err error) bool {
+	resolved := false
+	f.once.Do(func() {
+		f.value = value
+		f.err = err
+		close(f.done)
+		resolved = true
+	})
+	return resolved
+}
+
+// Done 结果就绪时关闭
+func (f *Future[R]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Await 等待结果. ctx 取消时返回 ctx.Err(), 数据仍然会被执行
+func (f *Future[R]) Await(ctx context.Context) (R, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero R
+		return zero, ctx.Err()
+	}
+}
+
+// Result 非阻塞获取结果, ok 为 false 表示还没有结果
+func (f *Future[R]) Result() (value R, err error, ok bool) {
+	select {
+	case <-f.done:
+		return f.value, f.err, true
+	default:
+		return value, nil, false
+	}
+}
@@ -0,0 +1,94 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrQueueFull 队列已满, TrySubmit 不等待
+var ErrQueueFull = errors.New("executor queue full")
+
+// Gate 执行器的投递入口. 关闭后投递返回 ErrClosed, 关闭返回后不会再有投递, 可以安全地关闭数据通道. 零值可用
+type Gate struct {
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Close 关闭入口, 等待正在进行的投递结束. 阻塞中的投递需要调用方先用 stop 唤醒
+func (g *Gate) Close() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+}
+
+// Closed 是否已关闭
+func (g *Gate) Closed() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.closed
+}
+
+// Send 投递到 ch, 队列满时等待直到 stop 关闭或 ctx 结束
+func Send[T any](g *Gate, ctx context.Context, ch chan<- T, v T, stop <-chan struct{}) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.closed {
+		return ErrClosed
+	}
+	select {
+	case ch <- v:
+		return nil
+	case <-stop:
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend 投递到 ch, 队列满时返回 ErrQueueFull
+func TrySend[T any](g *Gate, ch chan<- T, v T) error {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.closed {
+		return ErrClosed
+	}
+	select {
+	case ch <- v:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// flushPollInterval Flush 检查是否完成的间隔
+const flushPollInterval = time.Millisecond
+
+// Flush 等待调用前收集的数据全部执行或丢弃. stop 关闭时返回 ErrClosed.
+// 暂停中的数据要到 Resume 后才执行, 还有数据未完成时返回 ErrPaused
+func (m *Monitor) Flush(ctx context.Context, stop <-chan struct{}) error {
+	target := m.stats.collected.Load()
+	if m.stats.settled() >= target {
+		return nil
+	}
+
+	ticker := time.NewTicker(flushPollInterval)
+	defer ticker.Stop()
+
+	for m.stats.settled() < target {
+		if m.State() == StatePaused {
+			return ErrPaused
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-stop:
+			return ErrClosed
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
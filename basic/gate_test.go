@@ -0,0 +1,97 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestGateSend(t *testing.T) {
+	var g Gate
+	ch := make(chan int, 1)
+	stop := make(chan struct{})
+
+	if err := TrySend(&g, ch, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := TrySend(&g, ch, 2); err != ErrQueueFull {
+		t.Errorf("期望 ErrQueueFull, 实际 %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := Send(&g, ctx, ch, 2, stop); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 ctx 超时, 实际 %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- Send(&g, context.Background(), ch, 2, stop)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	close(stop)
+	g.Close()
+	if err := <-done; err != ErrClosed {
+		t.Errorf("stop 关闭后期望 ErrClosed, 实际 %v", err)
+	}
+	if err := TrySend(&g, ch, 3); err != ErrClosed {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+func TestMonitorFlush(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	if err := m.Flush(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Collected(3)
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		m.Execute(nil, 2, func(ctx context.Context) error { return nil })
+		m.Dropped(1, ErrClosed)
+	}()
+	if err := m.Flush(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Collected(1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := m.Flush(ctx, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 ctx 超时, 实际 %v", err)
+	}
+}
+
+func TestMonitorSettled(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.Collected(3)
+
+	settled := m.Settled()
+	select {
+	case <-settled:
+		t.Fatal("没有数据完成时不应该通知")
+	default:
+	}
+
+	m.Execute(nil, 2, func(ctx context.Context) error { return nil })
+	select {
+	case <-settled:
+	default:
+		t.Fatal("批次执行完期望通知")
+	}
+
+	settled = m.Settled()
+	m.Dropped(1, ErrClosed)
+	select {
+	case <-settled:
+	default:
+		t.Fatal("数据丢弃期望通知")
+	}
+
+	if stats := m.Stats(); stats.Collected != stats.Processed+stats.Dropped {
+		t.Errorf("期望全部完成, 实际 %+v", stats)
+	}
+}
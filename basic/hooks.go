@@ -0,0 +1,36 @@
+package basic
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Hooks 执行器生命周期的回调, 为 nil 的回调不调用. 回调的 panic 会被 recover 并记录日志
+type Hooks struct {
+	// OnBatchStart 批次执行前调用, 返回的 ctx 传给执行函数. 返回错误时跳过执行, 批次以该错误结束
+	OnBatchStart func(ctx context.Context, n int) (context.Context, error)
+	// OnBatchEnd 批次执行后调用, ctx 为 OnBatchStart 返回的 ctx, err 为批次的结果
+	OnBatchEnd func(ctx context.Context, n int, err error)
+	// OnIdle 执行完批次后队列为空, 执行器进入空闲时调用
+	OnIdle func()
+	// OnClose 执行器关闭时调用
+	OnClose func()
+}
+
+var noHooks = &Hooks{}
+
+// hooksHolder 可以在运行中替换的 Hooks
+type hooksHolder struct {
+	hooks atomic.Pointer[Hooks]
+}
+
+func (h *hooksHolder) set(hooks Hooks) {
+	h.hooks.Store(&hooks)
+}
+
+func (h *hooksHolder) get() *Hooks {
+	if hooks := h.hooks.Load(); hooks != nil {
+		return hooks
+	}
+	return noHooks
+}
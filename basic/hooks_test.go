@@ -0,0 +1,105 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+type txKey struct{}
+
+func TestMonitorHooks(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+
+	var ended []error
+	m.SetHooks(Hooks{
+		OnBatchStart: func(ctx context.Context, n int) (context.Context, error) {
+			return context.WithValue(ctx, txKey{}, n), nil
+		},
+		OnBatchEnd: func(ctx context.Context, n int, err error) {
+			if ctx.Value(txKey{}) != n {
+				t.Errorf("OnBatchEnd 的 ctx 应该是 OnBatchStart 返回的")
+			}
+			ended = append(ended, err)
+		},
+	})
+
+	err := m.Execute(nil, 2, func(ctx context.Context) error {
+		if ctx.Value(txKey{}) != 2 {
+			t.Errorf("执行函数的 ctx 应该是 OnBatchStart 返回的")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m.Execute(nil, 1, func(ctx context.Context) error {
+		panic("boom")
+	})
+
+	var perr *PanicError
+	if len(ended) != 2 || ended[0] != nil || !errors.As(ended[1], &perr) {
+		t.Errorf("OnBatchEnd 收到的错误不对 %v", ended)
+	}
+}
+
+func TestMonitorHooksStartError(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+
+	errTx := errors.New("begin tx")
+	var ended error
+	m.SetHooks(Hooks{
+		OnBatchStart: func(ctx context.Context, n int) (context.Context, error) {
+			return nil, errTx
+		},
+		OnBatchEnd: func(ctx context.Context, n int, err error) {
+			ended = err
+		},
+	})
+
+	executed := false
+	err := m.Execute(nil, 3, func(ctx context.Context) error {
+		executed = true
+		return nil
+	})
+	if executed || err != errTx || ended != errTx {
+		t.Errorf("OnBatchStart 返回错误时应该跳过执行 %v %v %v", executed, err, ended)
+	}
+	if stats := m.Stats(); stats.Failed != 3 || stats.LastError != errTx {
+		t.Errorf("统计错误 %+v", stats)
+	}
+}
+
+func TestMonitorHooksPanic(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelError)
+
+	m.SetHooks(Hooks{
+		OnBatchEnd: func(ctx context.Context, n int, err error) {
+			panic("end")
+		},
+		OnIdle: func() {
+			panic("idle")
+		},
+		OnClose: func() {
+			panic("close")
+		},
+	})
+
+	if err := m.Execute(nil, 1, func(ctx context.Context) error { return nil }); err != nil {
+		t.Errorf("OnBatchEnd 的 panic 不应该影响批次结果 %v", err)
+	}
+	m.Idle()
+	m.Shutdown()
+
+	var hooks []any
+	for _, r := range buf.records(t) {
+		if r["msg"] == "hook panic recovered" {
+			hooks = append(hooks, r[LogKeyHook])
+		}
+	}
+	if len(hooks) != 3 || hooks[0] != "OnBatchEnd" || hooks[1] != "OnIdle" || hooks[2] != "OnClose" {
+		t.Errorf("期望记录 3 个回调的 panic, 实际 %v", hooks)
+	}
+}
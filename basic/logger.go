@@ -0,0 +1,55 @@
+package basic
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// 日志事件的属性名, 所有执行器保持一致
+const (
+	LogKeyExecutor = "executor" // 执行器名称
+	LogKeyKind     = "kind"     // 执行器类型, 例如 periodic.ExecuteInterval
+	LogKeyItems    = "items"    // 数据数量
+	LogKeyDuration = "duration" // 批次耗时
+	LogKeyError    = "error"    // 错误
+	LogKeyPanic    = "panic"    // panic 的值
+	LogKeyStack    = "stack"    // panic 的堆栈
+	LogKeyReason   = "reason"   // 丢弃的原因
+	LogKeyHook     = "hook"     // panic 的回调名称
+)
+
+// loggerHolder 可并发替换的日志, 零值使用 slog.Default()
+type loggerHolder struct {
+	kind   string
+	name   atomic.Pointer[string]
+	logger atomic.Pointer[slog.Logger]
+}
+
+func (h *loggerHolder) set(logger *slog.Logger) {
+	h.logger.Store(logger)
+}
+
+func (h *loggerHolder) get() *slog.Logger {
+	if logger := h.logger.Load(); logger != nil {
+		return logger
+	}
+	return slog.Default()
+}
+
+// log 输出一条带执行器名称和类型的日志, 级别未开启时不构造属性
+func (h *loggerHolder) log(ctx context.Context, level slog.Level, msg string, attrs ...slog.Attr) {
+	logger := h.get()
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	head := make([]slog.Attr, 0, len(attrs)+2)
+	if name := h.name.Load(); name != nil {
+		head = append(head, slog.String(LogKeyExecutor, *name))
+	}
+	if h.kind != "" {
+		head = append(head, slog.String(LogKeyKind, h.kind))
+	}
+	logger.LogAttrs(ctx, level, msg, append(head, attrs...)...)
+}
@@ -0,0 +1,143 @@
+package basic
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// logBuffer 并发安全的 JSON 日志缓冲
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *logBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var r map[string]any
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	return records
+}
+
+func newTestMonitor(level slog.Level) (*Monitor, *logBuffer) {
+	buf := &logBuffer{}
+	m := &Monitor{}
+	m.SetKind("test.Executor")
+	m.SetName("orders")
+	m.SetLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: level})))
+	return m, buf
+}
+
+func TestMonitorLogPanic(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelInfo)
+
+	err := m.Execute(nil, 3, func(ctx context.Context) error {
+		panic("boom")
+	})
+	var perr *PanicError
+	if !errors.As(err, &perr) || len(perr.Stack) == 0 {
+		t.Fatalf("期望带堆栈的 *PanicError, 实际 %v", err)
+	}
+
+	var panicked map[string]any
+	for _, r := range buf.records(t) {
+		if r["msg"] == "batch panic recovered" {
+			panicked = r
+		}
+	}
+	if panicked == nil {
+		t.Fatal("没有 panic 日志")
+	}
+	if panicked[LogKeyExecutor] != "orders" || panicked[LogKeyKind] != "test.Executor" {
+		t.Errorf("执行器属性错误 %v", panicked)
+	}
+	if panicked[LogKeyItems] != float64(3) || panicked[LogKeyPanic] != "boom" {
+		t.Errorf("批次属性错误 %v", panicked)
+	}
+	if stack, _ := panicked[LogKeyStack].(string); !strings.Contains(stack, "TestMonitorLogPanic") {
+		t.Errorf("堆栈错误 %v", stack)
+	}
+}
+
+func TestMonitorLogLevels(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelInfo)
+
+	m.Execute(nil, 1, func(ctx context.Context) error { return nil })
+	if records := buf.records(t); len(records) != 0 {
+		t.Errorf("Info 级别不应该输出批次开始结束 %v", records)
+	}
+
+	m.Dropped(2, ErrBreakerOpen)
+	m.Expired(0)
+	m.Shutdown()
+
+	records := buf.records(t)
+	if len(records) != 2 {
+		t.Fatalf("期望 2 条日志, 实际 %v", records)
+	}
+	if records[0]["msg"] != "items dropped" || records[0][LogKeyReason] != ErrBreakerOpen.Error() || records[0][LogKeyItems] != float64(2) {
+		t.Errorf("丢弃日志错误 %v", records[0])
+	}
+	if records[1]["msg"] != "executor shutdown" || records[1][LogKeyExecutor] != "orders" {
+		t.Errorf("关闭日志错误 %v", records[1])
+	}
+
+	m, buf = newTestMonitor(slog.LevelDebug)
+	m.Execute(nil, 4, func(ctx context.Context) error { return nil })
+	records = buf.records(t)
+	if len(records) != 2 || records[0]["msg"] != "batch start" || records[1]["msg"] != "batch end" {
+		t.Fatalf("期望批次开始结束日志, 实际 %v", records)
+	}
+	if _, ok := records[1][LogKeyDuration]; !ok {
+		t.Errorf("批次结束没有耗时 %v", records[1])
+	}
+}
+
+func TestExpiryLogHookPanic(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelInfo)
+
+	var e Expiry[int]
+	e.SetOnExpired(func(item int) {
+		panic("hook")
+	})
+	live := e.Filter(m, []Entry[int]{{Item: 1, Deadline: time.Now().Add(-time.Second)}, {Item: 2}})
+	if len(live) != 1 || live[0].Item != 2 {
+		t.Fatalf("过滤错误 %v", live)
+	}
+
+	var hook, dropped bool
+	for _, r := range buf.records(t) {
+		switch r["msg"] {
+		case "hook panic recovered":
+			hook = r[LogKeyHook] == "OnExpired"
+		case "items dropped":
+			dropped = r[LogKeyReason] == "expired" && r[LogKeyItems] == float64(1)
+		}
+	}
+	if !hook || !dropped {
+		t.Errorf("期望回调 panic 和过期丢弃日志 %v", buf.records(t))
+	}
+}
@@ -0,0 +1,58 @@
+package basic
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics 执行器指标. 实现必须并发安全, 标签(例如执行器名称)由实现自己绑定
+type Metrics interface {
+	// Collected 收集了 n 个数据
+	Collected(n int)
+	// QueueDepth 当前队列中等待的数据量
+	QueueDepth(depth int)
+	// BatchExecuted 执行了一个批次
+	BatchExecuted(size int, elapsed time.Duration, err error)
+	// Panic 执行函数 panic 被 recover
+	Panic()
+	// Expired 过期丢弃了 n 个数据
+	Expired(n int)
+	// CompensateSleep 时间补偿等待的时长
+	CompensateSleep(d time.Duration)
+}
+
+// NopMetrics 不记录任何指标, 执行器的默认值
+type NopMetrics struct{}
+
+func (NopMetrics) Collected(n int)                                          {}
+func (NopMetrics) QueueDepth(depth int)                                     {}
+func (NopMetrics) BatchExecuted(size int, elapsed time.Duration, err error) {}
+func (NopMetrics) Panic()                                                   {}
+func (NopMetrics) Expired(n int)                                            {}
+func (NopMetrics) CompensateSleep(d time.Duration)                          {}
+
+type metricsBox struct {
+	m Metrics
+}
+
+var nopMetricsBox = &metricsBox{m: NopMetrics{}}
+
+// metricsHolder 可以在运行中替换的 Metrics
+type metricsHolder struct {
+	box atomic.Pointer[metricsBox]
+}
+
+func (h *metricsHolder) set(m Metrics) {
+	if m == nil {
+		h.box.Store(nil)
+		return
+	}
+	h.box.Store(&metricsBox{m: m})
+}
+
+func (h *metricsHolder) get() Metrics {
+	if box := h.box.Load(); box != nil {
+		return box.m
+	}
+	return nopMetricsBox.m
+}
@@ -0,0 +1,65 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// BatchHandler 批次处理函数, 执行器把自己的执行函数包装成 BatchHandler 交给中间件
+type BatchHandler[ITEM any] func(ctx context.Context, items []ITEM) error
+
+// Middleware 批次处理中间件, 在 next 前后加入横切逻辑
+type Middleware[ITEM any] func(next BatchHandler[ITEM]) BatchHandler[ITEM]
+
+// Chain 用中间件包装 handler, 第一个中间件在最外层
+func Chain[ITEM any](handler BatchHandler[ITEM], middlewares ...Middleware[ITEM]) BatchHandler[ITEM] {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// HandleItems 逐个执行数据, ctx 取消后不再执行剩下的数据. 返回所有错误的合并
+func HandleItems[ITEM any](ctx context.Context, items []ITEM, execDo func(ctx context.Context, item ITEM) error) error {
+	var errs []error
+	for _, item := range items {
+		if err := ctx.Err(); err != nil {
+			errs = append(errs, err)
+			break
+		}
+		if err := execDo(ctx, item); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// MiddlewareChain 执行器持有的中间件, 可以在运行中追加. 零值没有中间件
+type MiddlewareChain[ITEM any] struct {
+	mu          sync.Mutex
+	middlewares atomic.Pointer[[]Middleware[ITEM]]
+}
+
+// Use 追加中间件, 从下一个批次开始生效
+func (c *MiddlewareChain[ITEM]) Use(middlewares ...Middleware[ITEM]) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var chain []Middleware[ITEM]
+	if old := c.middlewares.Load(); old != nil {
+		chain = append(chain, *old...)
+	}
+	chain = append(chain, middlewares...)
+	c.middlewares.Store(&chain)
+}
+
+// Then 用当前的中间件包装 handler
+func (c *MiddlewareChain[ITEM]) Then(handler BatchHandler[ITEM]) BatchHandler[ITEM] {
+	chain := c.middlewares.Load()
+	if chain == nil {
+		return handler
+	}
+	return Chain(handler, *chain...)
+}
@@ -0,0 +1,240 @@
+package basic
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// Monitor 执行器批次执行的公共逻辑: recover 保护, 计时, 指标上报和日志. 零值可用
+type Monitor struct {
+	metrics metricsHolder
+	tracer  tracerHolder
+	logger  loggerHolder
+	stats   statsHolder
+	hooks   hooksHolder
+	timeout timeoutHolder
+	rate    rateHolder
+	pacer   pacer
+	pause   pauseHolder
+}
+
+// SetKind 设置执行器类型, 作为日志的 kind 属性. 只能在执行器启动前调用
+func (m *Monitor) SetKind(kind string) {
+	m.logger.kind = kind
+}
+
+// SetName 设置执行器名称, 作为日志的 executor 属性. 空字符串不输出这个属性
+func (m *Monitor) SetName(name string) {
+	if name == "" {
+		m.logger.name.Store(nil)
+		return
+	}
+	m.logger.name.Store(&name)
+}
+
+// SetLogger 设置日志, nil 恢复为 slog.Default()
+func (m *Monitor) SetLogger(logger *slog.Logger) {
+	m.logger.set(logger)
+}
+
+// SetMetrics 设置指标, nil 恢复为 NopMetrics
+func (m *Monitor) SetMetrics(metrics Metrics) {
+	m.metrics.set(metrics)
+}
+
+// Metrics 当前的指标
+func (m *Monitor) Metrics() Metrics {
+	return m.metrics.get()
+}
+
+// SetTracer 设置链路追踪, nil 不追踪
+func (m *Monitor) SetTracer(tracer Tracer) {
+	m.tracer.set(tracer)
+}
+
+// SetHooks 设置生命周期回调
+func (m *Monitor) SetHooks(hooks Hooks) {
+	m.hooks.set(hooks)
+}
+
+// SetState 设置生命周期状态
+func (m *Monitor) SetState(state State) {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+
+	if old := State(m.stats.state.Swap(int32(state))); old == StatePaused && state == StateClosed {
+		m.pause.abandoned = true
+	}
+	if state != StatePaused {
+		m.pause.release()
+	}
+	if state == StateClosed {
+		m.pause.shut()
+	}
+}
+
+// State 当前的生命周期状态
+func (m *Monitor) State() State {
+	return State(m.stats.state.Load())
+}
+
+// Stats 累计统计的快照, 队列相关的字段由执行器填写
+func (m *Monitor) Stats() Stats {
+	stats := m.stats.snapshot()
+	stats.Abandoned = int(m.timeout.abandoned.Load())
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道. 每个通道只通知一次, 之后需要重新获取
+func (m *Monitor) Settled() <-chan struct{} {
+	return m.stats.settle.wait()
+}
+
+// Collected 记录收集的数据量
+func (m *Monitor) Collected(n int) {
+	m.stats.collected.Add(uint64(n))
+	m.metrics.get().Collected(n)
+}
+
+// QueueDepth 记录队列深度
+func (m *Monitor) QueueDepth(depth int) {
+	m.metrics.get().QueueDepth(depth)
+}
+
+// Expired 记录过期丢弃的数据量
+func (m *Monitor) Expired(n int) {
+	if n > 0 {
+		m.stats.dropped.Add(uint64(n))
+		m.stats.settle.notify()
+		m.metrics.get().Expired(n)
+		m.logger.log(context.Background(), slog.LevelWarn, "items dropped",
+			slog.Int(LogKeyItems, n), slog.String(LogKeyReason, "expired"))
+	}
+}
+
+// Dropped 记录因 reason 没有执行的数据, 例如熔断转入死信或执行器关闭
+func (m *Monitor) Dropped(n int, reason error) {
+	if n > 0 {
+		m.stats.dropped.Add(uint64(n))
+		m.stats.settle.notify()
+		m.logger.log(context.Background(), slog.LevelWarn, "items dropped",
+			slog.Int(LogKeyItems, n), slog.String(LogKeyReason, reason.Error()))
+	}
+}
+
+// Shutdown 记录执行器关闭
+func (m *Monitor) Shutdown() {
+	m.logger.log(context.Background(), slog.LevelInfo, "executor shutdown")
+	if onClose := m.hooks.get().OnClose; onClose != nil {
+		m.callHook("OnClose", onClose)
+	}
+}
+
+// Idle 执行器进入空闲
+func (m *Monitor) Idle() {
+	if onIdle := m.hooks.get().OnIdle; onIdle != nil {
+		m.callHook("OnIdle", onIdle)
+	}
+}
+
+// callHook 调用回调, panic 只记录日志
+func (m *Monitor) callHook(hook string, do func()) {
+	// recover保护
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			m.Recovered(hook, ierr)
+		}
+	}()
+	do()
+}
+
+// Recovered 记录回调函数 hook 的 panic
+func (m *Monitor) Recovered(hook string, ierr any) {
+	m.logger.log(context.Background(), slog.LevelError, "hook panic recovered",
+		slog.String(LogKeyHook, hook), slog.Any(LogKeyPanic, ierr), slog.String(LogKeyStack, string(debug.Stack())))
+}
+
+// Execute 执行一个 size 大小的批次. panic 会被 recover 并转换为 *PanicError 返回.
+// 设置了 Tracer 时开始一个关联 links 的批次跨度, do 的 ctx 携带该跨度.
+// do 前后调用 Hooks 的 OnBatchStart 和 OnBatchEnd. 设置了执行超时时 do 在新协程中执行. 设置了限速时先等待令牌.
+// 暂停时等待到恢复, 暂停或限速的等待中关闭返回 ErrClosed 并计为丢弃
+func (m *Monitor) Execute(links []SpanContext, size int, do func(ctx context.Context) error) (err error) {
+	if err := m.waitResume(); err != nil {
+		m.Dropped(size, err)
+		return err
+	}
+	if err := m.throttle(context.Background(), size); err != nil {
+		m.Dropped(size, err)
+		return err
+	}
+
+	metrics := m.metrics.get()
+	hooks := m.hooks.get()
+
+	ctx := context.Background()
+	var span Span
+	if tracer := m.tracer.get(); tracer != nil {
+		ctx, span = tracer.Start(ctx, BatchSpanName, links)
+		span.SetAttribute("batch.size", size)
+	}
+
+	m.logger.log(ctx, slog.LevelDebug, "batch start", slog.Int(LogKeyItems, size))
+
+	m.stats.inflight.Add(1)
+	start := time.Now()
+	defer func() {
+		m.stats.inflight.Add(-1)
+
+		// recover保护
+		if ierr := recover(); ierr != nil {
+			err = m.panicked(ctx, size, ierr)
+		}
+		elapsed := time.Since(start)
+		if hooks.OnBatchEnd != nil {
+			m.callHook("OnBatchEnd", func() {
+				hooks.OnBatchEnd(ctx, size, err)
+			})
+		}
+		metrics.BatchExecuted(size, elapsed, err)
+		m.stats.batchExecuted(size, elapsed, err)
+
+		if err != nil {
+			m.logger.log(ctx, slog.LevelWarn, "batch end",
+				slog.Int(LogKeyItems, size), slog.Duration(LogKeyDuration, elapsed), slog.Any(LogKeyError, err))
+		} else {
+			m.logger.log(ctx, slog.LevelDebug, "batch end",
+				slog.Int(LogKeyItems, size), slog.Duration(LogKeyDuration, elapsed))
+		}
+
+		if span != nil {
+			if err != nil {
+				span.RecordError(err)
+			}
+			span.End()
+		}
+	}()
+
+	if hooks.OnBatchStart != nil {
+		hctx, herr := hooks.OnBatchStart(ctx, size)
+		if hctx != nil {
+			ctx = hctx
+		}
+		if herr != nil {
+			return herr
+		}
+	}
+	return m.run(ctx, size, do)
+}
+
+// CompensateSleep 时间补偿等待, 从 start 开始等到 periodic, 并记录等待时长
+func (m *Monitor) CompensateSleep(start time.Time, periodic *atomic.Int64, stop <-chan struct{}) {
+	d := time.Until(start.Add(time.Duration(periodic.Load())))
+	if d <= 0 {
+		return
+	}
+	m.metrics.get().CompensateSleep(d)
+	m.Pace(start, periodic, stop)
+}
@@ -0,0 +1,98 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+)
+
+// ErrPaused 执行器暂停中, 暂停时 Flush 不等待恢复
+var ErrPaused = errors.New("executor paused")
+
+// pauseHolder 暂停状态. resume 在暂停时创建, 离开暂停状态时关闭
+type pauseHolder struct {
+	mu        sync.Mutex
+	resume    chan struct{}
+	closed    chan struct{} // 状态变为 StateClosed 时关闭, 第一次使用时创建
+	abandoned bool          // 暂停中关闭, 之后开始的批次不再执行
+}
+
+// release 唤醒等待恢复的批次, 调用方持有 mu
+func (h *pauseHolder) release() {
+	if h.resume != nil {
+		close(h.resume)
+		h.resume = nil
+	}
+}
+
+// shut 关闭 closed, 调用方持有 mu
+func (h *pauseHolder) shut() {
+	if h.closed == nil {
+		h.closed = closedSignal
+		return
+	}
+	select {
+	case <-h.closed:
+	default:
+		close(h.closed)
+	}
+}
+
+// closing 状态变为 StateClosed 时关闭的通道, 用于中断等待
+func (m *Monitor) closing() <-chan struct{} {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+
+	if m.pause.closed == nil {
+		m.pause.closed = make(chan struct{})
+	}
+	return m.pause.closed
+}
+
+// Pause 暂停执行, 只有运行中的执行器可以暂停. 已经开始的批次执行完, 之后的批次在 Execute 中等待到 Resume,
+// 数据继续进入队列. 返回是否从运行中变为暂停
+func (m *Monitor) Pause() bool {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+
+	if !m.stats.state.CompareAndSwap(int32(StateRunning), int32(StatePaused)) {
+		return false
+	}
+	m.pause.resume = make(chan struct{})
+	m.logger.log(context.Background(), slog.LevelInfo, "executor paused")
+	return true
+}
+
+// Resume 恢复执行, 返回是否从暂停变为运行中
+func (m *Monitor) Resume() bool {
+	m.pause.mu.Lock()
+	defer m.pause.mu.Unlock()
+
+	if !m.stats.state.CompareAndSwap(int32(StatePaused), int32(StateRunning)) {
+		return false
+	}
+	m.pause.release()
+	m.logger.log(context.Background(), slog.LevelInfo, "executor resumed")
+	return true
+}
+
+// waitResume 暂停时等待离开暂停状态. 等待中或等待前暂停中被关闭返回 ErrClosed
+func (m *Monitor) waitResume() error {
+	m.pause.mu.Lock()
+	resume, abandoned := m.pause.resume, m.pause.abandoned
+	m.pause.mu.Unlock()
+
+	if abandoned {
+		// 执行循环取出批次时还在暂停, 关闭后才开始执行
+		return ErrClosed
+	}
+	if resume == nil {
+		return nil
+	}
+	<-resume
+	if m.State() == StateClosed {
+		return ErrClosed
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package basic
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestPauseResume(t *testing.T) {
+	m, buf := newTestMonitor(slog.LevelInfo)
+	if m.Pause() {
+		t.Error("没有运行的执行器不能暂停")
+	}
+
+	m.SetState(StateRunning)
+	if !m.Pause() || m.Pause() || m.State() != StatePaused {
+		t.Fatalf("期望暂停, 实际 %s", m.State())
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- m.Execute(nil, 2, func(ctx context.Context) error { return nil })
+	}()
+	select {
+	case <-done:
+		t.Fatal("暂停中不应该执行")
+	case <-time.After(time.Millisecond * 20):
+	}
+
+	if !m.Resume() || m.Resume() || m.State() != StateRunning {
+		t.Fatalf("期望恢复, 实际 %s", m.State())
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	m.Pause()
+	go func() {
+		done <- m.Execute(nil, 3, func(ctx context.Context) error { return nil })
+	}()
+	time.Sleep(time.Millisecond * 10)
+	m.SetState(StateClosed)
+	if err := <-done; err != ErrClosed {
+		t.Errorf("暂停中关闭期望 ErrClosed, 实际 %v", err)
+	}
+
+	// 暂停中关闭后才开始的批次同样丢弃
+	if err := m.Execute(nil, 1, func(ctx context.Context) error { return nil }); err != ErrClosed {
+		t.Errorf("暂停中关闭后期望 ErrClosed, 实际 %v", err)
+	}
+
+	stats := m.Stats()
+	if stats.Processed != 2 || stats.Dropped != 4 {
+		t.Errorf("统计错误 %+v", stats)
+	}
+	if recs := buf.records(t); len(recs) < 3 || recs[0]["msg"] != "executor paused" || recs[1]["msg"] != "executor resumed" {
+		t.Errorf("日志错误 %v", recs)
+	}
+}
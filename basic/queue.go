@@ -0,0 +1,154 @@
+package basic
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+)
+
+// Queue 执行器的数据队列. 默认是通道, UseRing 后改用无锁环形缓冲区, 切换前已在通道中的数据照常取出.
+// 消费者同时等待 C 和 Ready, 醒来后用 Drain 取走环形缓冲区的数据
+type Queue[T any] struct {
+	ch       chan T
+	ring     atomic.Pointer[Ring[T]]
+	ringOnce sync.Once
+	swapped  chan struct{} // UseRing 时关闭, 唤醒还在等待通道的消费者
+	done     chan struct{} // Close 时关闭, 唤醒等待环形缓冲区空位的 Put
+	doneOnce sync.Once
+}
+
+// NewQueue 创建容量为 size 的通道队列
+func NewQueue[T any](size int) *Queue[T] {
+	return &Queue[T]{
+		ch:      make(chan T, size),
+		swapped: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+// UseRing 改用容量不小于 size 的环形缓冲区, 只有第一次调用生效
+func (q *Queue[T]) UseRing(size int) {
+	q.ringOnce.Do(func() {
+		q.ring.Store(NewRing[T](size))
+		close(q.swapped)
+	})
+}
+
+// C 通道队列的数据
+func (q *Queue[T]) C() <-chan T {
+	return q.ch
+}
+
+// Ready 消费者等待环形缓冲区数据的通道. 没有使用环形缓冲区时只在 UseRing 时通知
+func (q *Queue[T]) Ready() <-chan struct{} {
+	if r := q.ring.Load(); r != nil {
+		return r.Ready()
+	}
+	return q.swapped
+}
+
+// Drain 把环形缓冲区的数据追加到 dst
+func (q *Queue[T]) Drain(dst []T) []T {
+	if r := q.ring.Load(); r != nil {
+		return r.Drain(dst)
+	}
+	return dst
+}
+
+// Take 非阻塞地取最多 n 个数据追加到 dst, 先取通道中的再取环形缓冲区的. 用于按数量分配的多个队列
+func (q *Queue[T]) Take(dst []T, n int) []T {
+	// 只有一个消费者, 通道中有数据时接收不会等待
+	for ; n > 0 && len(q.ch) > 0; n-- {
+		dst = append(dst, <-q.ch)
+	}
+	if r := q.ring.Load(); r != nil && n > 0 {
+		dst = r.DrainN(dst, n)
+	}
+	return dst
+}
+
+// Put 放入 v, 队列满时等待. 通道队列关闭后 panic, 环形缓冲区关闭后返回 ErrClosed
+func (q *Queue[T]) Put(v T) error {
+	if r := q.ring.Load(); r != nil {
+		select {
+		case <-q.done:
+			return ErrClosed
+		default:
+		}
+		return r.Push(context.Background(), v, q.done)
+	}
+	q.ch <- v
+	return nil
+}
+
+// Send 经过 g 放入 v, 队列满时等待直到 stop 关闭或 ctx 结束
+func (q *Queue[T]) Send(g *Gate, ctx context.Context, v T, stop <-chan struct{}) error {
+	r := q.ring.Load()
+	if r == nil {
+		return Send(g, ctx, q.ch, v, stop)
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.closed {
+		return ErrClosed
+	}
+	return r.Push(ctx, v, stop)
+}
+
+// TrySend 经过 g 放入 v, 队列满时返回 ErrQueueFull
+func (q *Queue[T]) TrySend(g *Gate, v T) error {
+	r := q.ring.Load()
+	if r == nil {
+		return TrySend(g, q.ch, v)
+	}
+
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	if g.closed {
+		return ErrClosed
+	}
+	if !r.TryPush(v) {
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Len 队列中的数据量
+func (q *Queue[T]) Len() int {
+	n := len(q.ch)
+	if r := q.ring.Load(); r != nil {
+		n += r.Len()
+	}
+	return n
+}
+
+// Cap 队列容量, 使用环形缓冲区时为环形缓冲区的容量
+func (q *Queue[T]) Cap() int {
+	if r := q.ring.Load(); r != nil {
+		return r.Cap()
+	}
+	return cap(q.ch)
+}
+
+// Discard 等待 Close 后取出剩下的全部数据, 返回数量. 执行循环退出时调用, 剩下的数据计为丢弃
+func (q *Queue[T]) Discard() int {
+	n := 0
+	for range q.ch {
+		n++
+	}
+	if r := q.ring.Load(); r != nil {
+		n += len(r.Drain(nil))
+	}
+	return n
+}
+
+// Close 关闭队列, 调用前需要关闭投递入口
+func (q *Queue[T]) Close() {
+	q.doneOnce.Do(func() {
+		close(q.done)
+		close(q.ch)
+	})
+}
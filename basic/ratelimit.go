@@ -0,0 +1,102 @@
+package basic
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// RateLimit 限速, 按数据量计算的令牌桶
+type RateLimit struct {
+	Rate  float64 // 每秒执行的数据量, 小于等于0不限速
+	Burst int     // 令牌桶容量, 允许的突发量. 小于等于0使用 Rate 向上取整
+}
+
+func (l RateLimit) String() string {
+	if l.Rate <= 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%g/s burst %d", l.Rate, l.Burst)
+}
+
+// rateHolder Monitor 的限速. 批次大于令牌桶容量时先透支, 等待令牌补足后执行
+type rateHolder struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+}
+
+func (h *rateHolder) set(limit RateLimit) RateLimit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if limit.Rate <= 0 {
+		limit = RateLimit{}
+	} else if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	old := h.limit
+	h.limit = limit
+	h.tokens = float64(limit.Burst)
+	h.last = time.Now()
+	return old
+}
+
+func (h *rateHolder) get() RateLimit {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.limit
+}
+
+// reserve 预定 n 个令牌, 返回需要等待的时间
+func (h *rateHolder) reserve(n int) time.Duration {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.limit.Rate <= 0 {
+		return 0
+	}
+
+	now := time.Now()
+	h.tokens = math.Min(float64(h.limit.Burst), h.tokens+now.Sub(h.last).Seconds()*h.limit.Rate)
+	h.last = now
+	h.tokens -= float64(n)
+	if h.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-h.tokens / h.limit.Rate * float64(time.Second))
+}
+
+// SetRateLimit 设置限速, 批次执行前等待足够的令牌. Rate 小于等于0取消限速
+func (m *Monitor) SetRateLimit(limit RateLimit) {
+	m.rate.set(limit)
+}
+
+// RateLimit 当前的限速
+func (m *Monitor) RateLimit() RateLimit {
+	return m.rate.get()
+}
+
+// throttle 按限速等待 size 个数据的令牌. 等待中关闭返回 ErrClosed, ctx 结束返回 ctx.Err()
+func (m *Monitor) throttle(ctx context.Context, size int) error {
+	wait := m.rate.reserve(size)
+	if wait <= 0 {
+		return nil
+	}
+	m.logger.log(ctx, slog.LevelDebug, "batch rate limited", slog.Int(LogKeyItems, size), slog.Duration(LogKeyDuration, wait))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-m.closing():
+		return ErrClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -1,5 +1,7 @@
 package basic
 
+import "fmt"
+
 type RecoverFunc struct {
 	RecoverDo func(ierr any)
 }
@@ -7,3 +9,13 @@ type RecoverFunc struct {
 func (rf *RecoverFunc) SetRecover(rdo func(ierr any)) {
 	rf.RecoverDo = rdo
 }
+
+// PanicError 执行函数 panic 后被 recover 转换成的错误
+type PanicError struct {
+	Value any
+	Stack []byte // recover 时的堆栈
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
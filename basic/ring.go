@@ -0,0 +1,170 @@
+package basic
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// ringBackoff Push 队列满时自旋后等待的间隔
+const ringBackoff = 50 * time.Microsecond
+
+// ringSpins Push 队列满时让出 CPU 重试的次数, 超过后按 ringBackoff 等待
+const ringSpins = 16
+
+// closedSignal 已关闭的通知通道, Ready 有数据时返回
+var closedSignal = func() chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}()
+
+// Ring 无锁的多生产者单消费者环形缓冲区. 生产者 CAS head 预留槽位后写入, 写入完成发布槽位的序号;
+// 消费者一次取走 tail 之后所有已写入的连续槽位, 最后一次原子写 tail 归还全部槽位, 不需要逐个数据同步.
+// Drain 和 Ready 只能由一个协程调用
+type Ring[T any] struct {
+	_     [64]byte
+	head  atomic.Uint64 // 下一个预留的位置, 生产者 CAS
+	_     [56]byte
+	tail  atomic.Uint64 // 下一个消费的位置, 只由消费者写
+	_     [56]byte
+	slots []ringSlot[T]
+	mask  uint64
+
+	sleeping atomic.Bool   // 消费者准备等待 notify
+	notify   chan struct{} // 消费者等待时写入数据的通知
+}
+
+type ringSlot[T any] struct {
+	seq   atomic.Uint64 // 位置 pos 写入完成时为 pos+1
+	value T
+}
+
+// NewRing 创建容量不小于 size 的环形缓冲区, 容量向上取 2 的幂
+func NewRing[T any](size int) *Ring[T] {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &Ring[T]{
+		slots:  make([]ringSlot[T], n),
+		mask:   uint64(n - 1),
+		notify: make(chan struct{}, 1),
+	}
+}
+
+// TryPush 放入 v, 缓冲区满时返回 false
+func (r *Ring[T]) TryPush(v T) bool {
+	for {
+		// 先读 tail 再读 head, head 不会小于 tail, 相减不会溢出
+		tail := r.tail.Load()
+		head := r.head.Load()
+		if head-tail >= uint64(len(r.slots)) {
+			return false
+		}
+		if r.head.CompareAndSwap(head, head+1) {
+			slot := &r.slots[head&r.mask]
+			slot.value = v
+			slot.seq.Store(head + 1)
+			r.wake()
+			return true
+		}
+	}
+}
+
+// Push 放入 v, 缓冲区满时等待直到 stop 关闭或 ctx 结束
+func (r *Ring[T]) Push(ctx context.Context, v T, stop <-chan struct{}) error {
+	var timer *time.Timer
+	for spin := 0; !r.TryPush(v); spin++ {
+		if spin < ringSpins {
+			runtime.Gosched()
+			continue
+		}
+		if timer == nil {
+			timer = time.NewTimer(ringBackoff)
+			defer timer.Stop()
+		} else {
+			timer.Reset(ringBackoff)
+		}
+		select {
+		case <-stop:
+			return ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return nil
+}
+
+// Drain 把已写入的数据追加到 dst, 遇到已预留未写入的槽位停止
+func (r *Ring[T]) Drain(dst []T) []T {
+	return r.DrainN(dst, 0)
+}
+
+// DrainN 同 Drain, 最多取 n 个. n 小于等于0不限制
+func (r *Ring[T]) DrainN(dst []T, n int) []T {
+	tail := r.tail.Load()
+	head := r.head.Load()
+	if n > 0 && head-tail > uint64(n) {
+		head = tail + uint64(n)
+	}
+
+	var zero T
+	pos := tail
+	for ; pos != head; pos++ {
+		slot := &r.slots[pos&r.mask]
+		if slot.seq.Load() != pos+1 {
+			break
+		}
+		dst = append(dst, slot.value)
+		slot.value = zero
+	}
+	if pos != tail {
+		r.tail.Store(pos)
+	}
+	return dst
+}
+
+// Ready 返回消费者等待数据的通道. 已有数据时返回已关闭的通道, 否则下一次写入时通知
+func (r *Ring[T]) Ready() <-chan struct{} {
+	r.sleeping.Store(true)
+	if r.available() {
+		r.sleeping.Store(false)
+		return closedSignal
+	}
+	return r.notify
+}
+
+// Len 已预留的槽位数, 包括还在写入的
+func (r *Ring[T]) Len() int {
+	// 先读 tail 再读 head, 消费者在两次读之间取走数据也不会得到负数
+	tail := r.tail.Load()
+	head := r.head.Load()
+	if head < tail {
+		return 0
+	}
+	return int(head - tail)
+}
+
+// Cap 容量
+func (r *Ring[T]) Cap() int {
+	return len(r.slots)
+}
+
+// available tail 的槽位是否已写入
+func (r *Ring[T]) available() bool {
+	tail := r.tail.Load()
+	return r.slots[tail&r.mask].seq.Load() == tail+1
+}
+
+// wake 消费者在等待时通知. 消费者先标记等待再检查数据, 生产者先发布数据再检查标记, 不会都错过
+func (r *Ring[T]) wake() {
+	if r.sleeping.Load() && r.sleeping.CompareAndSwap(true, false) {
+		select {
+		case r.notify <- struct{}{}:
+		default:
+		}
+	}
+}
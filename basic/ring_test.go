@@ -0,0 +1,242 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing[int](3)
+	if r.Cap() != 4 {
+		t.Fatalf("容量期望向上取 2 的幂 4, 实际 %d", r.Cap())
+	}
+
+	for i := 0; i < 4; i++ {
+		if !r.TryPush(i) {
+			t.Fatalf("第 %d 个放入失败", i)
+		}
+	}
+	if r.TryPush(4) {
+		t.Error("满时期望放入失败")
+	}
+	select {
+	case <-r.Ready():
+	default:
+		t.Error("有数据时 Ready 期望立即返回")
+	}
+
+	got := r.Drain(nil)
+	if len(got) != 4 || got[0] != 0 || got[3] != 3 {
+		t.Fatalf("期望取出 [0 1 2 3], 实际 %v", got)
+	}
+	if r.Len() != 0 {
+		t.Errorf("取出后期望为空, 实际 %d", r.Len())
+	}
+
+	ready := r.Ready()
+	select {
+	case <-ready:
+		t.Fatal("没有数据时 Ready 不能返回")
+	default:
+	}
+	r.TryPush(4)
+	select {
+	case <-ready:
+	case <-time.After(time.Second):
+		t.Fatal("放入后期望通知等待的消费者")
+	}
+	if got := r.Drain(got[:0]); len(got) != 1 || got[0] != 4 {
+		t.Errorf("绕回后期望取出 [4], 实际 %v", got)
+	}
+}
+
+func TestRingPush(t *testing.T) {
+	r := NewRing[int](1)
+	r.TryPush(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := r.Push(ctx, 2, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望 ctx 超时, 实际 %v", err)
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := r.Push(context.Background(), 2, stop); err != ErrClosed {
+		t.Errorf("stop 关闭后期望 ErrClosed, 实际 %v", err)
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- r.Push(context.Background(), 2, nil)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	r.Drain(nil)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if got := r.Drain(nil); len(got) != 1 || got[0] != 2 {
+		t.Errorf("期望取出等待放入的数据, 实际 %v", got)
+	}
+}
+
+func TestRingDrainN(t *testing.T) {
+	r := NewRing[int](4)
+	// 多次绕回后空的缓冲区仍然可以放满
+	for round := 0; round < 10; round++ {
+		for i := 0; i < 4; i++ {
+			if !r.TryPush(i) {
+				t.Fatalf("第 %d 轮第 %d 个放入失败", round, i)
+			}
+		}
+		if got := r.DrainN(nil, 3); len(got) != 3 || got[2] != 2 {
+			t.Fatalf("期望最多取出 3 个, 实际 %v", got)
+		}
+		if got := r.DrainN(nil, 3); len(got) != 1 || got[0] != 3 {
+			t.Fatalf("期望取出剩下的 [3], 实际 %v", got)
+		}
+	}
+
+	var g Gate
+	q := NewQueue[int](4)
+	q.Put(1)
+	q.Put(2)
+	q.UseRing(4)
+	q.TrySend(&g, 3)
+	q.TrySend(&g, 4)
+	if got := q.Take(nil, 3); len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("期望先取通道再取环形缓冲区 [1 2 3], 实际 %v", got)
+	}
+	q.TrySend(&g, 5)
+	g.Close()
+	q.Close()
+	if n := q.Discard(); n != 2 {
+		t.Errorf("期望丢弃环形缓冲区剩下的 2 个, 实际 %d", n)
+	}
+}
+
+// TestRingProducers 多个生产者并发放入, 每个数据恰好取出一次, 同一生产者的数据保持顺序
+func TestRingProducers(t *testing.T) {
+	const producers, n = 8, 20000
+	r := NewRing[[2]int](64)
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if err := r.Push(context.Background(), [2]int{p, i}, nil); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(p)
+	}
+
+	next := make([]int, producers)
+	var buf [][2]int
+	for total := 0; total < producers*n; {
+		<-r.Ready()
+		buf = r.Drain(buf[:0])
+		for _, v := range buf {
+			if v[1] != next[v[0]] {
+				t.Fatalf("生产者 %d 期望 %d, 实际 %d", v[0], next[v[0]], v[1])
+			}
+			next[v[0]]++
+		}
+		total += len(buf)
+	}
+	wg.Wait()
+
+	if r.Len() != 0 {
+		t.Errorf("期望全部取出, 剩余 %d", r.Len())
+	}
+}
+
+func TestQueueUseRing(t *testing.T) {
+	var g Gate
+	q := NewQueue[int](4)
+	q.Put(1)
+
+	ready := q.Ready()
+	q.UseRing(2)
+	select {
+	case <-ready:
+	default:
+		t.Fatal("切换后期望唤醒等待通道的消费者")
+	}
+	if q.Cap() != 2 {
+		t.Errorf("期望环形缓冲区容量 2, 实际 %d", q.Cap())
+	}
+
+	q.Put(2)
+	if err := q.TrySend(&g, 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.TrySend(&g, 4); err != ErrQueueFull {
+		t.Errorf("期望 ErrQueueFull, 实际 %v", err)
+	}
+	if q.Len() != 3 {
+		t.Errorf("期望通道和环形缓冲区共 3 个, 实际 %d", q.Len())
+	}
+	if v := <-q.C(); v != 1 {
+		t.Errorf("切换前的数据期望从通道取出, 实际 %d", v)
+	}
+	if got := q.Drain(nil); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("期望取出 [2 3], 实际 %v", got)
+	}
+
+	g.Close()
+	q.Close()
+	if err := q.Send(&g, context.Background(), 5, nil); err != ErrClosed {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+	if err := q.Put(5); err != ErrClosed {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+// BenchmarkQueue 多个生产者放入, 一个消费者取出. channel 逐个接收, ring 一次取走全部
+func BenchmarkQueue(b *testing.B) {
+	const size = 1 << 12
+
+	b.Run("channel", func(b *testing.B) {
+		ch := make(chan int, size)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for n := 0; n < b.N; n++ {
+				<-ch
+			}
+		}()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ch <- 1
+			}
+		})
+		<-done
+	})
+
+	b.Run("ring", func(b *testing.B) {
+		r := NewRing[int](size)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			var buf []int
+			for n := 0; n < b.N; n += len(buf) {
+				<-r.Ready()
+				buf = r.Drain(buf[:0])
+			}
+		}()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				r.Push(context.Background(), 1, nil)
+			}
+		})
+		<-done
+	})
+}
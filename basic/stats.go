@@ -0,0 +1,148 @@
+package basic
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// State 执行器的生命周期状态
+type State int32
+
+const (
+	// StateCreated 已创建, 还没有开始执行
+	StateCreated State = iota
+	// StateRunning 运行中
+	StateRunning
+	// StateStopped 已停止, 可以重新开始
+	StateStopped
+	// StateClosed 已关闭, 不能再使用
+	StateClosed
+	// StatePaused 已暂停, 继续接收数据但不执行
+	StatePaused
+	// StateStopping 停止中, 正在执行剩下的数据
+	StateStopping
+)
+
+func (s State) String() string {
+	switch s {
+	case StateCreated:
+		return "created"
+	case StateRunning:
+		return "running"
+	case StateStopped:
+		return "stopped"
+	case StateClosed:
+		return "closed"
+	case StatePaused:
+		return "paused"
+	case StateStopping:
+		return "stopping"
+	default:
+		return "unknown"
+	}
+}
+
+// Stats 执行器运行状态的快照. 数量都以数据为单位, 从执行器创建开始累计
+type Stats struct {
+	State     State
+	QueueLen  int // 队列中等待的数据量
+	QueueCap  int // 队列容量, 0 表示不限制
+	InFlight  int // 正在执行的批次数, 并发执行器即工作中的协程数
+	Abandoned int // 执行超时后还在后台运行的执行函数数
+
+	Collected uint64 // 收集的数据量
+	Processed uint64 // 交给执行函数的数据量, 包含失败的
+	Failed    uint64 // 批次返回错误或 panic 的数据量
+	Dropped   uint64 // 没有执行就被丢弃的数据量, 例如过期或转入死信
+
+	LastBatchSize     int           // 最近一个批次的数据量
+	LastBatchDuration time.Duration // 最近一个批次的耗时
+	LastBatchAt       time.Time     // 最近一个批次的结束时间, 零值表示还没有执行过
+	LastError         error         // 最近一个失败批次的错误
+}
+
+type lastBatch struct {
+	size     int
+	duration time.Duration
+	at       time.Time
+}
+
+type errorBox struct {
+	err error
+}
+
+// statsHolder Monitor 内部的累计统计
+type statsHolder struct {
+	state     atomic.Int32
+	inflight  atomic.Int64
+	collected atomic.Uint64
+	processed atomic.Uint64
+	failed    atomic.Uint64
+	dropped   atomic.Uint64
+	last      atomic.Pointer[lastBatch]
+	lastErr   atomic.Pointer[errorBox]
+	settle    settleSignal
+}
+
+// settleSignal 数据执行完或被丢弃的通知. 等待方取得当前的通道, 下一次变化时关闭并换新的通道
+type settleSignal struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+func (s *settleSignal) wait() <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ch == nil {
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
+
+func (s *settleSignal) notify() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ch != nil {
+		close(s.ch)
+		s.ch = nil
+	}
+}
+
+func (h *statsHolder) batchExecuted(size int, elapsed time.Duration, err error) {
+	h.processed.Add(uint64(size))
+	defer h.settle.notify()
+	if err != nil {
+		h.failed.Add(uint64(size))
+		h.lastErr.Store(&errorBox{err: err})
+	}
+	h.last.Store(&lastBatch{size: size, duration: elapsed, at: time.Now()})
+}
+
+// settled 已经执行或丢弃的数据量
+func (h *statsHolder) settled() uint64 {
+	return h.processed.Load() + h.dropped.Load()
+}
+
+func (h *statsHolder) snapshot() Stats {
+	// 先读执行和丢弃的数量再读收集的数量, Collected 不会小于 Processed+Dropped
+	stats := Stats{
+		State:    State(h.state.Load()),
+		InFlight: int(h.inflight.Load()),
+		Failed:   h.failed.Load(),
+		Dropped:  h.dropped.Load(),
+	}
+	stats.Processed = h.processed.Load()
+	stats.Collected = h.collected.Load()
+	if last := h.last.Load(); last != nil {
+		stats.LastBatchSize = last.size
+		stats.LastBatchDuration = last.duration
+		stats.LastBatchAt = last.at
+	}
+	if box := h.lastErr.Load(); box != nil {
+		stats.LastError = box.err
+	}
+	return stats
+}
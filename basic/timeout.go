@@ -0,0 +1,110 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+// ErrHandlerTimeout 批次执行超时, errors.Is(err, context.DeadlineExceeded) 为 true
+var ErrHandlerTimeout = fmt.Errorf("handler timeout: %w", context.DeadlineExceeded)
+
+// AbandonPolicy 执行超时后对仍在运行的执行函数的处理策略
+type AbandonPolicy int32
+
+const (
+	// AbandonDetach 取消 ctx 后立即返回, 执行函数所在的协程在后台运行到结束. 执行器马上可以执行下一个批次
+	AbandonDetach AbandonPolicy = iota
+	// AbandonWait 取消 ctx 后等待执行函数返回, 批次仍记为超时. 适合不能并发执行的函数
+	AbandonWait
+)
+
+// timeoutHolder 批次执行超时的配置
+type timeoutHolder struct {
+	timeout   atomic.Int64
+	policy    atomic.Int32
+	abandoned atomic.Int64 // 超时后还在运行的协程数
+}
+
+// SetHandlerTimeout 设置批次执行超时, 超时后 ctx 被取消, 批次以 ErrHandlerTimeout 结束. 小于等于0不超时
+func (m *Monitor) SetHandlerTimeout(d time.Duration) {
+	m.timeout.timeout.Store(int64(d))
+}
+
+// SetAbandonPolicy 设置执行超时后的处理策略, 默认 AbandonDetach
+func (m *Monitor) SetAbandonPolicy(policy AbandonPolicy) {
+	m.timeout.policy.Store(int32(policy))
+}
+
+// HandlerTimeout 当前的批次执行超时
+func (m *Monitor) HandlerTimeout() time.Duration {
+	return time.Duration(m.timeout.timeout.Load())
+}
+
+// RunTimeout 按超时配置执行 do, 不经过暂停, 限速, 回调和统计. 超时返回 ErrHandlerTimeout,
+// 在新协程中执行时 panic 转换为 *PanicError. 用于中间件复用执行器的超时和放弃策略
+func (m *Monitor) RunTimeout(ctx context.Context, size int, do func(ctx context.Context) error) error {
+	return m.run(ctx, size, do)
+}
+
+// run 按超时配置执行 do
+func (m *Monitor) run(ctx context.Context, size int, do func(ctx context.Context) error) error {
+	timeout := m.HandlerTimeout()
+	if timeout <= 0 {
+		return do(ctx)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	done := make(chan error, 1)
+	go func() {
+		// recover保护, 协程中的 panic 不能让进程退出
+		defer func() {
+			if ierr := recover(); ierr != nil {
+				done <- m.panicked(ctx, size, ierr)
+			}
+		}()
+		done <- do(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		cancel()
+		return err
+	case <-ctx.Done():
+	}
+
+	if AbandonPolicy(m.timeout.policy.Load()) == AbandonWait {
+		<-done
+		cancel()
+	} else {
+		m.timeout.abandoned.Add(1)
+		go func() {
+			<-done
+			cancel()
+			m.timeout.abandoned.Add(-1)
+			m.logger.log(ctx, slog.LevelInfo, "abandoned handler returned", slog.Int(LogKeyItems, size))
+		}()
+	}
+
+	m.logger.log(ctx, slog.LevelWarn, "handler timeout",
+		slog.Int(LogKeyItems, size), slog.Duration(LogKeyDuration, timeout))
+	return ErrHandlerTimeout
+}
+
+// panicked 记录批次的 panic 并转换为 *PanicError
+func (m *Monitor) panicked(ctx context.Context, size int, ierr any) *PanicError {
+	perr := &PanicError{Value: ierr, Stack: debug.Stack()}
+	m.logger.log(ctx, slog.LevelError, "batch panic recovered",
+		slog.Int(LogKeyItems, size), slog.Any(LogKeyPanic, ierr), slog.String(LogKeyStack, string(perr.Stack)))
+	m.metrics.get().Panic()
+	return perr
+}
+
+// Abandoned err 是否表示批次执行超时后执行函数被放弃, 仍在后台运行
+func (m *Monitor) Abandoned(err error) bool {
+	return errors.Is(err, ErrHandlerTimeout) && AbandonPolicy(m.timeout.policy.Load()) == AbandonDetach
+}
@@ -0,0 +1,75 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestHandlerTimeoutDetach(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.SetHandlerTimeout(time.Millisecond * 20)
+
+	release := make(chan struct{})
+	canceled := make(chan struct{})
+	start := time.Now()
+	err := m.Execute(nil, 2, func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		<-release
+		return nil
+	})
+	if err != ErrHandlerTimeout || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("期望超时, 实际 %v", err)
+	}
+	if time.Since(start) > time.Millisecond*200 {
+		t.Error("AbandonDetach 不应该等待执行函数返回")
+	}
+	<-canceled
+
+	stats := m.Stats()
+	if stats.Abandoned != 1 || stats.InFlight != 0 || stats.Failed != 2 || stats.LastError != ErrHandlerTimeout {
+		t.Errorf("统计错误 %+v", stats)
+	}
+
+	close(release)
+	time.Sleep(time.Millisecond * 10)
+	if m.Stats().Abandoned != 0 {
+		t.Errorf("执行函数返回后不应该再计入 Abandoned")
+	}
+}
+
+func TestHandlerTimeoutWait(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.SetHandlerTimeout(time.Millisecond * 10)
+	m.SetAbandonPolicy(AbandonWait)
+
+	returned := false
+	err := m.Execute(nil, 1, func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(time.Millisecond * 20)
+		returned = true
+		return ctx.Err()
+	})
+	if err != ErrHandlerTimeout || !returned {
+		t.Errorf("AbandonWait 应该等待执行函数返回 %v %v", err, returned)
+	}
+	if m.Stats().Abandoned != 0 {
+		t.Errorf("AbandonWait 不应该有 Abandoned")
+	}
+}
+
+func TestHandlerTimeoutPanic(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.SetHandlerTimeout(time.Second)
+
+	err := m.Execute(nil, 1, func(ctx context.Context) error {
+		panic("boom")
+	})
+	var perr *PanicError
+	if !errors.As(err, &perr) || perr.Value != "boom" {
+		t.Errorf("期望执行协程的 panic 转换为错误, 实际 %v", err)
+	}
+}
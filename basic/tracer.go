@@ -0,0 +1,99 @@
+package basic
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// BatchSpanName 批次执行跨度的名称
+const BatchSpanName = "execute.batch"
+
+// SpanContext 跨度的标识
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+}
+
+// IsValid 是否是有效的跨度
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != "" && sc.SpanID != ""
+}
+
+// Span 执行中的跨度
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	End()
+}
+
+// Tracer 链路追踪接口, 形状参考 OpenTelemetry. 实现必须并发安全
+type Tracer interface {
+	// SpanContextFromContext 取出 ctx 中当前的跨度
+	SpanContextFromContext(ctx context.Context) (SpanContext, bool)
+	// Start 开始一个新的跨度并关联 links, 返回携带该跨度的 ctx
+	Start(ctx context.Context, name string, links []SpanContext) (context.Context, Span)
+}
+
+type tracerBox struct {
+	t Tracer
+}
+
+// tracerHolder 可以在运行中替换的 Tracer, 默认不追踪
+type tracerHolder struct {
+	box atomic.Pointer[tracerBox]
+}
+
+func (h *tracerHolder) set(t Tracer) {
+	if t == nil {
+		h.box.Store(nil)
+		return
+	}
+	h.box.Store(&tracerBox{t: t})
+}
+
+func (h *tracerHolder) get() Tracer {
+	if box := h.box.Load(); box != nil {
+		return box.t
+	}
+	return nil
+}
+
+// SpanLinks 取出批次中数据所在的跨度, 去重. 没有设置 Tracer 时返回 nil
+func SpanLinks[ITEM any](m *Monitor, entries []Entry[ITEM]) []SpanContext {
+	if m.tracer.get() == nil {
+		return nil
+	}
+
+	ctxs := make([]context.Context, 0, len(entries))
+	for _, entry := range entries {
+		ctxs = append(ctxs, entry.Ctx)
+	}
+	return ContextLinks(m, ctxs...)
+}
+
+// ContextLinks 取出 ctxs 所在的跨度, 去重. 没有设置 Tracer 时返回 nil
+func ContextLinks(m *Monitor, ctxs ...context.Context) []SpanContext {
+	tracer := m.tracer.get()
+	if tracer == nil {
+		return nil
+	}
+
+	var links []SpanContext
+	seen := make(map[SpanContext]struct{})
+	for _, ctx := range ctxs {
+		if ctx == nil {
+			continue
+		}
+		sc, ok := tracer.SpanContextFromContext(ctx)
+		if !ok || !sc.IsValid() {
+			continue
+		}
+		if _, ok := seen[sc]; ok {
+			continue
+		}
+		seen[sc] = struct{}{}
+		links = append(links, sc)
+	}
+	return links
+}
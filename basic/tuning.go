@@ -0,0 +1,149 @@
+package basic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Tuning 运行中可以修改的参数, 由执行器的 Reconfigure 应用. 零值字段保持不变
+type Tuning struct {
+	Periodic    time.Duration // 执行周期
+	BatchSize   int           // 批次数量
+	Concurrency int           // 同时执行的批次数
+	Capacity    int           // 等待执行的数据上限, 只适用于设置了 capacity 的执行器
+	RateLimit   *RateLimit    // 限速, nil 保持不变
+}
+
+// TuningField 执行器支持修改的参数, RateLimit 所有执行器都支持
+type TuningField uint8
+
+const (
+	TunePeriodic TuningField = 1 << iota
+	TuneBatchSize
+	TuneConcurrency
+	TuneCapacity
+)
+
+// TuningError Reconfigure 的参数错误
+type TuningError struct {
+	Field  string
+	Value  any
+	Reason string
+}
+
+func (e *TuningError) Error() string {
+	return fmt.Sprintf("reconfigure: field %s=%v: %s", e.Field, e.Value, e.Reason)
+}
+
+// Change 一个参数的修改
+type Change struct {
+	Field string
+	Old   any
+	New   any
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v -> %v", c.Field, c.Old, c.New)
+}
+
+// Changed 旧值和新值不同时追加一个修改
+func Changed(changes []Change, field string, old, new any) []Change {
+	if old == new {
+		return changes
+	}
+	return append(changes, Change{Field: field, Old: old, New: new})
+}
+
+// Validate 检查 t 的字段是否合法以及是否在 supported 中, 返回所有 *TuningError 的合并
+func (t *Tuning) Validate(supported TuningField) error {
+	var errs []error
+	check := func(field string, value int64, flag TuningField) {
+		switch {
+		case value < 0:
+			errs = append(errs, &TuningError{Field: field, Value: value, Reason: "must not be negative"})
+		case value != 0 && supported&flag == 0:
+			errs = append(errs, &TuningError{Field: field, Value: value, Reason: "not supported by this executor"})
+		}
+	}
+	check("periodic", int64(t.Periodic), TunePeriodic)
+	check("batch_size", int64(t.BatchSize), TuneBatchSize)
+	check("concurrency", int64(t.Concurrency), TuneConcurrency)
+	check("capacity", int64(t.Capacity), TuneCapacity)
+	if t.RateLimit != nil && t.RateLimit.Burst < 0 {
+		errs = append(errs, &TuningError{Field: "rate_burst", Value: t.RateLimit.Burst, Reason: "must not be negative"})
+	}
+	return errors.Join(errs...)
+}
+
+// Reconfigure 检查 t 并应用限速, 返回限速的修改. 执行器在没有错误时再应用自己的参数, 保证要么全部生效要么都不生效
+func (m *Monitor) Reconfigure(t Tuning, supported TuningField) ([]Change, error) {
+	if err := t.Validate(supported); err != nil {
+		return nil, err
+	}
+	if t.RateLimit == nil {
+		return nil, nil
+	}
+
+	old := m.rate.set(*t.RateLimit)
+	return Changed(nil, "rate_limit", old, m.rate.get()), nil
+}
+
+// Reconfigured 记录参数修改的日志, 返回 changes
+func (m *Monitor) Reconfigured(changes []Change) []Change {
+	if len(changes) != 0 {
+		attrs := make([]slog.Attr, 0, len(changes))
+		for _, c := range changes {
+			attrs = append(attrs, slog.String(c.Field, fmt.Sprintf("%v -> %v", c.Old, c.New)))
+		}
+		m.logger.log(context.Background(), slog.LevelInfo, "executor reconfigured", attrs...)
+	}
+	return changes
+}
+
+// pacer 批次之间的等待, 修改周期后唤醒等待重新计算
+type pacer struct {
+	once sync.Once
+	wake chan struct{}
+}
+
+func (p *pacer) channel() chan struct{} {
+	p.once.Do(func() {
+		p.wake = make(chan struct{}, 1)
+	})
+	return p.wake
+}
+
+// Wake 唤醒 Pace 中的等待, 按新的周期重新计算. 修改周期后调用
+func (m *Monitor) Wake() {
+	select {
+	case m.pacer.channel() <- struct{}{}:
+	default:
+	}
+}
+
+// Pace 从 start 开始等待 periodic 纳秒. Wake 后按 periodic 的新值重新计算, stop 关闭时立即返回
+func (m *Monitor) Pace(start time.Time, periodic *atomic.Int64, stop <-chan struct{}) {
+	wake := m.pacer.channel()
+	for {
+		d := time.Until(start.Add(time.Duration(periodic.Load())))
+		if d <= 0 {
+			return
+		}
+
+		timer := time.NewTimer(d)
+		select {
+		case <-timer.C:
+			return
+		case <-stop:
+			timer.Stop()
+			return
+		case <-wake:
+			timer.Stop()
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package basic
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.SetRateLimit(RateLimit{Rate: 100, Burst: 10})
+	if limit := m.RateLimit(); limit.String() != "100/s burst 10" {
+		t.Errorf("限速错误 %s", limit)
+	}
+
+	noop := func(ctx context.Context) error { return nil }
+	start := time.Now()
+	m.Execute(nil, 10, noop)
+	if time.Since(start) > time.Millisecond*20 {
+		t.Error("令牌桶容量内不应该等待")
+	}
+
+	start = time.Now()
+	m.Execute(nil, 5, noop)
+	if elapsed := time.Since(start); elapsed < time.Millisecond*40 {
+		t.Errorf("期望等待约 50ms, 实际 %s", elapsed)
+	}
+
+	m.SetRateLimit(RateLimit{})
+	start = time.Now()
+	m.Execute(nil, 1000, noop)
+	if time.Since(start) > time.Millisecond*20 || m.RateLimit().String() != "unlimited" {
+		t.Error("取消限速后不应该等待")
+	}
+}
+
+func TestRateLimitClose(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	m.SetRateLimit(RateLimit{Rate: 1, Burst: 1})
+
+	var executed atomic.Bool
+	done := make(chan error)
+	go func() {
+		done <- m.Execute(nil, 10, func(ctx context.Context) error {
+			executed.Store(true)
+			return nil
+		})
+	}()
+	time.Sleep(time.Millisecond * 20)
+	m.SetState(StateClosed)
+
+	select {
+	case err := <-done:
+		if err != ErrClosed {
+			t.Errorf("期望 ErrClosed, 实际 %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("关闭后期望中断限速等待")
+	}
+	if executed.Load() || m.Stats().Dropped != 10 {
+		t.Errorf("期望不执行并计为丢弃, 实际 %+v", m.Stats())
+	}
+	if err := m.throttle(context.Background(), 10); err != ErrClosed {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+func TestTuningValidate(t *testing.T) {
+	tuning := Tuning{Periodic: -1, BatchSize: 10, Concurrency: 2, RateLimit: &RateLimit{Burst: -1}}
+	err := tuning.Validate(TunePeriodic | TuneConcurrency)
+	want := "reconfigure: field periodic=-1: must not be negative\n" +
+		"reconfigure: field batch_size=10: not supported by this executor\n" +
+		"reconfigure: field rate_burst=-1: must not be negative"
+	if err == nil || err.Error() != want {
+		t.Errorf("期望\n%s\n实际\n%v", want, err)
+	}
+}
+
+func TestPaceWake(t *testing.T) {
+	m, _ := newTestMonitor(slog.LevelError)
+	var periodic atomic.Int64
+	periodic.Store(int64(time.Hour))
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		periodic.Store(int64(time.Millisecond * 20))
+		m.Wake()
+	}()
+
+	start := time.Now()
+	m.Pace(start, &periodic, nil)
+	if elapsed := time.Since(start); elapsed < time.Millisecond*20 || elapsed > time.Millisecond*200 {
+		t.Errorf("唤醒后应该按新周期从 start 计算, 实际等待 %s", elapsed)
+	}
+}
@@ -1,12 +1,15 @@
 package periodic
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/utils"
 )
 
@@ -19,27 +22,56 @@ type ConcurrentExecute[ITEM any] struct {
 type concurrentExecuteSub[ITEM any] struct {
 	periodic      atomic.Int64
 	concurrentNum atomic.Uint64
+	running       atomic.Int64  // 正在执行的批次数
+	workerDone    chan struct{} // 批次执行完的通知
+
+	poolMode     atomic.Int32 // PoolMode
+	subBatchSize atomic.Int64 // PoolWorkStealing 的子批次大小
+	poolStarted  bool         // 执行循环已按 poolMode 创建 pool
+	poolSize     atomic.Int64 // pool 的工作协程数, 创建后作为并发数. 0 表示还没有创建或 PoolSpawn
+	pool         workerPool   // 只在执行循环中使用, PoolSpawn 为 nil
 
 	// 要执行的函数
-	execDo func(item ITEM)
+	execDo func(ctx context.Context, item ITEM) error
 
 	loopExecuteOnce sync.Once
 	stopChan        chan struct{}
 	stopOnce        utils.OnceNoWait
-	itemsChan       chan ITEM
+	items           *basic.Queue[basic.Entry[ITEM]]
+	gate            basic.Gate
+
+	guard      basic.BreakerGuard[ITEM]
+	expiry     basic.Expiry[ITEM]
+	batches    basic.BatchPool[ITEM]
+	committer  basic.Committer[ITEM]
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[ITEM]
 }
 
 func NewConcurrentExecute[ITEM any](execDo func(item ITEM)) *ConcurrentExecute[ITEM] {
+	return NewConcurrentExecuteContext(func(ctx context.Context, item ITEM) error {
+		execDo(item)
+		return nil
+	})
+}
+
+// NewConcurrentExecuteContext 以带上下文的执行函数创建. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消,
+// 返回的错误合并为批次的错误
+func NewConcurrentExecuteContext[ITEM any](execDo func(ctx context.Context, item ITEM) error) *ConcurrentExecute[ITEM] {
 	e := &ConcurrentExecute[ITEM]{
 		sub: &concurrentExecuteSub[ITEM]{
 			// periodic: time.Millisecond * 100,
-			itemsChan: make(chan ITEM, 1<<16),
-			execDo:    execDo,
+			stopChan:   make(chan struct{}),
+			items:      basic.NewQueue[basic.Entry[ITEM]](1 << 16),
+			workerDone: make(chan struct{}, 1),
+			execDo:     execDo,
 		},
 	}
 	e.sub.periodic.Store(int64(time.Millisecond) * 100)
 	e.sub.concurrentNum.Store(uint64(runtime.NumCPU()))
 
+	e.sub.monitor.SetKind("periodic.ConcurrentExecute")
+	e.sub.monitor.SetState(basic.StateRunning)
 	e.loopExecute()
 
 	runtime.SetFinalizer(e, func(ee *ConcurrentExecute[ITEM]) {
@@ -56,16 +88,256 @@ func (pe *ConcurrentExecute[ITEM]) WithPeriodic(per time.Duration) *ConcurrentEx
 	return pe
 }
 
+// WithConcurrent 设置同时执行的批次数, 默认 runtime.NumCPU(). 小于1按1处理, 下一个批次开始时生效.
+// 工作协程池创建后并发数固定为工作协程数, 再调用不生效
+func (pe *ConcurrentExecute[ITEM]) WithConcurrent(n int) *ConcurrentExecute[ITEM] {
+	if n < 1 {
+		n = 1
+	}
+	if pe.sub.poolSize.Load() > 0 {
+		return pe
+	}
+	pe.sub.concurrentNum.Store(uint64(n))
+	return pe
+}
+
+// WithPoolMode 设置执行批次的方式, 默认 PoolSpawn. 在第一个批次开始时生效, 之后修改不再生效.
+// 工作协程池的协程数为当时的并发数, 之后不能通过 WithConcurrent 或 Reconfigure 修改
+func (pe *ConcurrentExecute[ITEM]) WithPoolMode(mode PoolMode) *ConcurrentExecute[ITEM] {
+	pe.sub.poolMode.Store(int32(mode))
+	return pe
+}
+
+// WithSubBatchSize 设置 PoolWorkStealing 的子批次大小. 小于等于0时每次取出的数据切分为工作协程数的 4 倍
+func (pe *ConcurrentExecute[ITEM]) WithSubBatchSize(n int) *ConcurrentExecute[ITEM] {
+	pe.sub.subBatchSize.Store(int64(n))
+	return pe
+}
+
+// WithOnCommit 设置批次的提交函数. 批次并发执行, 执行完后严格按批次开始的顺序调用提交函数, seq 从 1 开始.
+// 执行失败, 超时和关闭时丢弃的批次同样提交, err 为批次的错误, 只有 err 为 nil 时才能提交消费位置.
+// AbandonDetach 下超时的批次以 basic.ErrHandlerTimeout 提交时执行函数可能还在运行. 熔断丢弃的批次不提交.
+// PoolWorkStealing 下每个子批次一个序号. 提交时还会使用批次的数据, 设置后批次缓冲不再复用, 每个批次重新分配
+func (pe *ConcurrentExecute[ITEM]) WithOnCommit(onCommitDo func(seq uint64, items []ITEM, err error)) *ConcurrentExecute[ITEM] {
+	pe.sub.committer.SetOnCommit(onCommitDo)
+	return pe
+}
+
+// WithCircuitBreaker 设置熔断器. 熔断打开时按 policy 暂停消费或转入死信
+func (pe *ConcurrentExecute[ITEM]) WithCircuitBreaker(cb *basic.CircuitBreaker, policy basic.BreakerPolicy) *ConcurrentExecute[ITEM] {
+	pe.sub.guard.SetBreaker(cb, policy)
+	return pe
+}
+
+// WithDeadLetter 设置熔断打开时的死信处理函数, 只在 basic.BreakerDeadLetter 策略下生效. 函数收到数据的副本, panic 会被 recover
+func (pe *ConcurrentExecute[ITEM]) WithDeadLetter(deadLetterDo func(items []ITEM)) *ConcurrentExecute[ITEM] {
+	pe.sub.guard.SetDeadLetter(deadLetterDo)
+	return pe
+}
+
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (pe *ConcurrentExecute[ITEM]) WithMetrics(metrics basic.Metrics) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetMetrics(metrics)
+	return pe
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (pe *ConcurrentExecute[ITEM]) WithTracer(tracer basic.Tracer) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetTracer(tracer)
+	return pe
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (pe *ConcurrentExecute[ITEM]) WithLogger(logger *slog.Logger) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetLogger(logger)
+	return pe
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (pe *ConcurrentExecute[ITEM]) WithName(name string) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetName(name)
+	return pe
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (pe *ConcurrentExecute[ITEM]) WithHooks(hooks basic.Hooks) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetHooks(hooks)
+	return pe
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (pe *ConcurrentExecute[ITEM]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *ConcurrentExecute[ITEM] {
+	pe.sub.middleware.Use(middlewares...)
+	return pe
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后取消 ctx, 批次以 basic.ErrHandlerTimeout 结束并继续执行下一个批次. 小于等于0不超时
+func (pe *ConcurrentExecute[ITEM]) WithHandlerTimeout(d time.Duration) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetHandlerTimeout(d)
+	return pe
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach
+func (pe *ConcurrentExecute[ITEM]) WithAbandonPolicy(policy basic.AbandonPolicy) *ConcurrentExecute[ITEM] {
+	pe.sub.monitor.SetAbandonPolicy(policy)
+	return pe
+}
+
+// WithTTL 设置数据的存活时间, 从收集时开始计算, 过期的数据在执行前被丢弃. 小于等于0不过期
+func (pe *ConcurrentExecute[ITEM]) WithTTL(ttl time.Duration) *ConcurrentExecute[ITEM] {
+	pe.sub.expiry.SetTTL(ttl)
+	return pe
+}
+
+// WithOnExpired 设置过期数据的处理函数
+func (pe *ConcurrentExecute[ITEM]) WithOnExpired(onExpiredDo func(item ITEM)) *ConcurrentExecute[ITEM] {
+	pe.sub.expiry.SetOnExpired(onExpiredDo)
+	return pe
+}
+
+// WithRingBuffer 使用容量不小于 size 的无锁环形缓冲区代替通道作为数据队列, 容量向上取 2 的幂.
+// 多个协程高频收集时, 执行循环每次取走全部已写入的数据, 不需要逐个接收. 只有第一次调用生效
+func (pe *ConcurrentExecute[ITEM]) WithRingBuffer(size int) *ConcurrentExecute[ITEM] {
+	pe.sub.items.UseRing(size)
+	return pe
+}
+
 // Collect 收集数据
 func (exec *ConcurrentExecute[ITEM]) Collect(item ITEM) {
-	exec.sub.itemsChan <- item
+	exec.collect(exec.sub.expiry.Entry(item))
+}
+
+// CollectContext 收集数据并携带上下文, 批次跨度会关联 ctx 中的跨度
+func (exec *ConcurrentExecute[ITEM]) CollectContext(ctx context.Context, item ITEM) {
+	entry := exec.sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	exec.collect(entry)
+}
+
+// CollectWithTTL 收集数据并指定存活时间
+func (exec *ConcurrentExecute[ITEM]) CollectWithTTL(item ITEM, ttl time.Duration) {
+	exec.CollectWithDeadline(item, time.Now().Add(ttl))
+}
+
+// CollectWithDeadline 收集数据并指定过期时间
+func (exec *ConcurrentExecute[ITEM]) CollectWithDeadline(item ITEM, deadline time.Time) {
+	exec.collect(exec.sub.expiry.EntryWithDeadline(item, deadline))
+}
+
+func (exec *ConcurrentExecute[ITEM]) collect(entry basic.Entry[ITEM]) {
+	if err := exec.sub.items.Put(entry); err != nil {
+		// 已关闭
+		return
+	}
+	exec.sub.monitor.Collected(1)
+	exec.sub.monitor.QueueDepth(exec.sub.items.Len())
+}
+
+// Submit 投递数据, 队列满时等待. 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err(). 批次跨度会关联 ctx 中的跨度
+func (exec *ConcurrentExecute[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	sub := exec.sub
+	entry := sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	if err := sub.items.Send(&sub.gate, ctx, entry, sub.stopChan); err != nil {
+		return err
+	}
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(sub.items.Len())
+	return nil
+}
+
+// TrySubmit 投递数据, 队列满时返回 basic.ErrQueueFull
+func (exec *ConcurrentExecute[ITEM]) TrySubmit(item ITEM) error {
+	sub := exec.sub
+	if err := sub.items.TrySend(&sub.gate, sub.expiry.Entry(item)); err != nil {
+		return err
+	}
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(sub.items.Len())
+	return nil
+}
+
+// Flush 等待已收集的数据全部执行或丢弃, 设置了 WithOnCommit 时还等待执行完的批次全部提交
+func (exec *ConcurrentExecute[ITEM]) Flush(ctx context.Context) error {
+	if err := exec.sub.monitor.Flush(ctx, exec.sub.stopChan); err != nil {
+		return err
+	}
+	return exec.sub.committer.Wait(ctx)
+}
+
+// Shutdown 停止接收 Submit, 等待已收集的数据执行完后关闭. ctx 结束时立即关闭并返回 ctx.Err()
+func (exec *ConcurrentExecute[ITEM]) Shutdown(ctx context.Context) error {
+	exec.sub.gate.Close()
+	err := exec.Flush(ctx)
+	exec.Close()
+	return err
+}
+
+// Expired 过期丢弃的数量
+func (exec *ConcurrentExecute[ITEM]) Expired() uint64 {
+	return exec.sub.expiry.Expired()
+}
+
+// Reconfigure 修改运行中的参数: 执行周期, 并发数和限速. 参数都合法时全部生效, 否则都不生效. 返回实际的修改.
+// 使用工作协程池时并发数不能修改
+func (exec *ConcurrentExecute[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	sub := exec.sub
+	if t.Concurrency > 0 && PoolMode(sub.poolMode.Load()) != PoolSpawn {
+		return nil, &basic.TuningError{Field: "concurrency", Value: t.Concurrency, Reason: "fixed by worker pool"}
+	}
+	changes, err := sub.monitor.Reconfigure(t, basic.TunePeriodic|basic.TuneConcurrency)
+	if err != nil {
+		return nil, err
+	}
+	if t.Periodic > 0 {
+		old := time.Duration(sub.periodic.Swap(int64(t.Periodic)))
+		changes = basic.Changed(changes, "periodic", old, t.Periodic)
+		sub.monitor.Wake()
+	}
+	if t.Concurrency > 0 {
+		old := int(sub.concurrentNum.Swap(uint64(t.Concurrency)))
+		changes = basic.Changed(changes, "concurrency", old, t.Concurrency)
+		// 等待空闲并发数的循环重新检查
+		select {
+		case sub.workerDone <- struct{}{}:
+		default:
+		}
+	}
+	return sub.monitor.Reconfigured(changes), nil
+}
+
+// Pause 暂停执行, 继续接收数据. 正在执行的批次执行完, 之后的批次等待到 Resume. 暂停中关闭时等待的批次被丢弃
+func (exec *ConcurrentExecute[ITEM]) Pause() {
+	exec.sub.monitor.Pause()
+}
+
+// Resume 恢复执行
+func (exec *ConcurrentExecute[ITEM]) Resume() {
+	exec.sub.monitor.Resume()
+}
+
+// Stats 运行状态的快照
+func (exec *ConcurrentExecute[ITEM]) Stats() basic.Stats {
+	sub := exec.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = sub.items.Len()
+	stats.QueueCap = sub.items.Cap()
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (exec *ConcurrentExecute[ITEM]) Settled() <-chan struct{} {
+	return exec.sub.monitor.Settled()
 }
 
 // Stop 停止执行
 func (exec *ConcurrentExecute[ITEM]) Close() {
 	exec.sub.stopOnce.Do(func() {
+		exec.sub.monitor.SetState(basic.StateClosed)
+		exec.sub.monitor.Shutdown()
 		close(exec.sub.stopChan)
-		close(exec.sub.itemsChan)
+		exec.sub.gate.Close()
+		exec.sub.items.Close()
 	})
 
 }
@@ -74,78 +346,212 @@ func (exec *ConcurrentExecute[ITEM]) loopExecute() {
 	sub := exec.sub
 	sub.loopExecuteOnce.Do(func() {
 
-		// 创建工作池
-		pool := make(chan struct{}, sub.concurrentNum.Load())
-		for i := uint64(0); i < sub.concurrentNum.Load(); i++ {
-			pool <- struct{}{}
-		}
-
 		go func() {
 
-			var items []ITEM
+			var entries []basic.Entry[ITEM]
 
 			for {
 				select {
 				case <-sub.stopChan:
-					// 收到停止信号，退出循环
+					// 收到停止信号，退出循环. 队列中剩下的数据计为丢弃
+					sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
 					return
-				case item := <-sub.itemsChan:
+				case entry, ok := <-sub.items.C():
+					if !ok {
+						// 已关闭
+						sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
+						return
+					}
 					// log.Println(" param := <-exec.params 1 ")
-					items = append(items, item)
-
-					func() {
-						for {
-
-							select {
-							case item := <-sub.itemsChan:
-								// log.Println(" param := <-exec.params 2 ")
-								items = append(items, item)
-							default:
-								func() {
-									if len(items) == 0 {
-										return
+					entries = append(entries, entry)
+				case <-sub.items.Ready():
+					// 环形缓冲区有数据, 在下面一起取出
+				}
+
+				func() {
+					for {
+
+						select {
+						case entry, ok := <-sub.items.C():
+							if !ok {
+								sub.monitor.Dropped(len(entries), basic.ErrClosed)
+								entries = entries[:0]
+								return
+							}
+							// log.Println(" param := <-exec.params 2 ")
+							entries = append(entries, entry)
+						default:
+							entries = sub.items.Drain(entries)
+							if len(entries) == 0 {
+								// 没有取到数据
+								return
+							}
+							func() {
+								if len(entries) == 0 {
+									return
+								}
+
+								// 丢弃过期的数据
+								live := sub.expiry.Filter(&sub.monitor, entries)
+								sub.monitor.QueueDepth(sub.items.Len())
+								if len(live) == 0 {
+									entries = entries[:0]
+									return
+								}
+
+								// 批次交给其他协程执行, 每个批次使用自己的缓冲
+								batch := sub.batches.Get()
+								batch.Items = basic.ItemsOf(live, batch.Items)
+								links := basic.SpanLinks(&sub.monitor, live)
+								entries = entries[:0]
+
+								release, err := sub.guard.Acquire(&sub.monitor, sub.stopChan, batch.Items)
+								if err != nil {
+									sub.monitor.Dropped(len(batch.Items), err)
+									sub.batches.Put(&sub.monitor, batch, nil)
+									return
+								}
+
+								// 等待有空闲的并发数, 关闭时批次计为丢弃
+								pool := sub.workerPool()
+								if !sub.acquire() {
+									release(basic.ErrClosed)
+									sub.monitor.Dropped(len(batch.Items), basic.ErrClosed)
+									sub.batches.Put(&sub.monitor, batch, nil)
+									return
+								}
+
+								jobs := sub.jobs(links, batch, release)
+								if pool != nil {
+									pool.submit(jobs)
+								} else {
+									for _, job := range jobs {
+										go job()
 									}
+								}
 
-									curItems := items[:]
-									items = items[:0]
+								sub.monitor.Pace(time.Now(), &sub.periodic, sub.stopChan)
+							}()
+							if sub.items.Len() == 0 {
+								sub.monitor.Idle()
+							}
+							return
+						}
+					}
 
-									// 获取工作池的token
-									<-pool
+				}()
 
-									// #1 这里想添加 协程序控制数量,结合整个结构,应该怎么实现最好
-									go func() {
-										// recover保护
-										defer func() {
-											if ierr := recover(); ierr != nil {
-												log.Println(ierr)
-											}
-											// 释放token
-											pool <- struct{}{}
-										}()
+			}
 
-										for _, item := range curItems {
-											sub.execDo(item)
-										}
+		}()
+	})
+}
 
-									}()
+// workerPool 第一个批次时按 poolMode 创建工作协程池, 只在执行循环中调用
+func (sub *concurrentExecuteSub[ITEM]) workerPool() workerPool {
+	if !sub.poolStarted {
+		sub.poolStarted = true
+		n := int(sub.concurrentNum.Load())
+		sub.pool = newWorkerPool(PoolMode(sub.poolMode.Load()), n, sub.stopChan)
+		if sub.pool != nil {
+			sub.poolSize.Store(int64(n))
+		}
+	}
+	return sub.pool
+}
 
-									periodic := time.Duration(sub.periodic.Load())
-									time.Sleep(periodic)
-								}()
-								return
-							}
-						}
+// concurrency 同时执行的批次数. 创建工作协程池后为工作协程数, 不受之后的修改影响
+func (sub *concurrentExecuteSub[ITEM]) concurrency() int64 {
+	if n := sub.poolSize.Load(); n > 0 {
+		return n
+	}
+	return int64(sub.concurrentNum.Load())
+}
 
-					}()
+// acquire 等待正在执行的批次数小于并发数后占用一个, stopChan 关闭时返回 false
+func (sub *concurrentExecuteSub[ITEM]) acquire() bool {
+	for sub.running.Load() >= sub.concurrency() {
+		select {
+		case <-sub.workerDone:
+		case <-sub.stopChan:
+			return false
+		}
+	}
+	sub.running.Add(1)
+	return true
+}
 
-				}
+// jobs 把批次转换为执行任务, 每个任务执行一个批次后按顺序提交. PoolWorkStealing 切分为多个子批次,
+// 子批次全部执行完后以合并的错误调用 release, 再放回批次缓冲并释放占用的并发数.
+// 设置了提交函数时数据在提交时还会被使用, 缓冲不放回
+func (sub *concurrentExecuteSub[ITEM]) jobs(links []basic.SpanContext, batch *basic.Batch[ITEM], release func(err error)) []func() {
+	items := batch.Items
+	reuse := !sub.committer.Enabled()
+	size := len(items)
+	if PoolMode(sub.poolMode.Load()) == PoolWorkStealing {
+		size = int(sub.subBatchSize.Load())
+		if size <= 0 {
+			parts := int(sub.concurrency()) * 4
+			size = (len(items) + parts - 1) / parts
+		}
+		size = max(size, 1)
+	}
+
+	var mu sync.Mutex
+	var errs []error
+	remain := (len(items) + size - 1) / size
 
+	jobs := make([]func(), 0, remain)
+	for start := 0; start < len(items); start += size {
+		end := min(start+size, len(items))
+		part := items[start:end:end]
+		seq := sub.committer.Next()
+
+		jobs = append(jobs, func() {
+			err := sub.execute(links, part)
+			sub.committer.Done(&sub.monitor, seq, part, err)
+
+			mu.Lock()
+			if err != nil {
+				errs = append(errs, err)
+			}
+			remain--
+			last := remain == 0
+			mu.Unlock()
+			if last {
+				defer sub.done()
+				err := errors.Join(errs...)
+				release(err)
+				if reuse {
+					sub.batches.Put(&sub.monitor, batch, err)
+				}
 			}
+		})
+	}
+	return jobs
+}
 
-		}()
+// done 一个批次执行完, 通知等待空闲并发数的执行循环
+func (sub *concurrentExecuteSub[ITEM]) done() {
+	sub.running.Add(-1)
+	select {
+	case sub.workerDone <- struct{}{}:
+	default:
+	}
+}
+
+// execute 执行一个批次, panic 会被 recover 并转换为 error
+func (sub *concurrentExecuteSub[ITEM]) execute(links []basic.SpanContext, items []ITEM) error {
+	return sub.monitor.Execute(links, len(items), func(ctx context.Context) error {
+		return sub.middleware.Then(sub.handle)(ctx, items)
 	})
 }
 
+// handle 逐个执行数据, 是中间件链的最内层
+func (sub *concurrentExecuteSub[ITEM]) handle(ctx context.Context, items []ITEM) error {
+	return basic.HandleItems(ctx, items, sub.execDo)
+}
+
 // // ConcurrentExecute 定期并发
 // type ConcurrentExecute[ITEM any] struct {
 // 	periodic time.Duration // 周期的时间
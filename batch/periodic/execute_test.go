@@ -1,11 +1,16 @@
 package periodic_test
 
 import (
+	"context"
+	"errors"
 	"log"
+	"reflect"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/batch/periodic"
 )
 
@@ -79,3 +84,343 @@ func TestA3(t *testing.T) {
 // 	}
 // 	time.Sleep(time.Millisecond * 2000)
 // }
+
+func TestCircuitBreaker(t *testing.T) {
+	var executed atomic.Int32
+	var dead atomic.Int32
+
+	cb := basic.NewCircuitBreaker(basic.BreakerConfig{
+		ConsecutiveFailures: 2,
+		OpenTimeout:         time.Hour,
+	})
+
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		executed.Add(1)
+		panic("downstream is down")
+	}).WithPeriodic(time.Millisecond*10).
+		WithCircuitBreaker(cb, basic.BreakerDeadLetter).
+		WithDeadLetter(func(items []int) {
+			dead.Add(int32(len(items)))
+		})
+	defer e.Close()
+
+	for i := 0; i < 5; i++ {
+		e.Collect(i)
+		time.Sleep(time.Millisecond * 30)
+	}
+
+	if executed.Load() != 2 {
+		t.Errorf("熔断后不应该再执行, 期望执行 2 次, 实际 %d", executed.Load())
+	}
+	if dead.Load() != 3 {
+		t.Errorf("期望死信 3 个, 实际 %d", dead.Load())
+	}
+	if cb.State() != basic.BreakerOpen {
+		t.Errorf("期望熔断打开, 实际 %s", cb.State())
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var executed atomic.Int32
+	var expired atomic.Int32
+	block := make(chan struct{})
+
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		if item == -1 {
+			<-block
+			return
+		}
+		executed.Add(1)
+	}).WithPeriodic(time.Millisecond).
+		WithTTL(time.Millisecond * 30).
+		WithOnExpired(func(item int) {
+			expired.Add(1)
+		})
+	defer e.Close()
+
+	// 阻塞执行, 让后面的数据积压
+	e.Collect(-1)
+	time.Sleep(time.Millisecond * 10)
+
+	e.Collect(1)
+	e.Collect(2)
+	e.CollectWithTTL(3, time.Second)
+	e.CollectWithDeadline(4, time.Now().Add(time.Millisecond*5))
+
+	time.Sleep(time.Millisecond * 50)
+	close(block)
+	time.Sleep(time.Millisecond * 50)
+
+	if executed.Load() != 1 {
+		t.Errorf("期望只执行未过期的 1 个, 实际 %d", executed.Load())
+	}
+	if expired.Load() != 3 || e.Expired() != 3 {
+		t.Errorf("期望过期 3 个, 实际 %d %d", expired.Load(), e.Expired())
+	}
+}
+
+func TestStats(t *testing.T) {
+	block := make(chan struct{})
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		if item == -1 {
+			<-block
+		}
+		if item == 0 {
+			panic("item 0")
+		}
+	}).WithPeriodic(time.Millisecond)
+
+	if stats := e.Stats(); stats.State != basic.StateRunning || stats.QueueCap != 1<<16 {
+		t.Fatalf("初始状态错误 %+v", stats)
+	}
+
+	e.Collect(-1)
+	time.Sleep(time.Millisecond * 20)
+	// 阻塞时收集的数据在下一个批次一起执行
+	e.Collect(0)
+	e.Collect(1)
+	if stats := e.Stats(); stats.InFlight != 1 || stats.QueueLen != 2 {
+		t.Errorf("期望 1 个批次执行中 2 个等待, 实际 %+v", stats)
+	}
+	close(block)
+	time.Sleep(time.Millisecond * 50)
+
+	stats := e.Stats()
+	if stats.InFlight != 0 || stats.Collected != 3 || stats.Processed != 3 || stats.Failed != 2 {
+		t.Errorf("统计错误 %+v", stats)
+	}
+	if stats.LastBatchSize != 2 || stats.LastBatchAt.IsZero() {
+		t.Errorf("最近批次错误 %+v", stats)
+	}
+	var perr *basic.PanicError
+	if !errors.As(stats.LastError, &perr) {
+		t.Errorf("期望最近错误为 panic, 实际 %v", stats.LastError)
+	}
+
+	e.Close()
+	if e.Stats().State != basic.StateClosed {
+		t.Errorf("期望已关闭, 实际 %s", e.Stats().State)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		record("item")
+	}).WithPeriodic(time.Millisecond).WithHooks(basic.Hooks{
+		OnBatchStart: func(ctx context.Context, n int) (context.Context, error) {
+			record("begin")
+			return ctx, nil
+		},
+		OnBatchEnd: func(ctx context.Context, n int, err error) {
+			record("commit")
+		},
+		OnIdle: func() {
+			record("idle")
+		},
+		OnClose: func() {
+			record("close")
+		},
+	})
+
+	e.Collect(1)
+	time.Sleep(time.Millisecond * 30)
+	e.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(events, []string{"begin", "item", "commit", "idle", "close"}) {
+		t.Errorf("回调顺序错误 %v", events)
+	}
+}
+
+func TestHandlerTimeout(t *testing.T) {
+	var executed atomic.Int32
+	hang := make(chan struct{})
+	defer close(hang)
+
+	e := periodic.NewExecuteIntervalContext[int](func(ctx context.Context, item int) error {
+		if item == -1 {
+			<-hang
+		}
+		executed.Add(1)
+		return nil
+	}).WithPeriodic(time.Millisecond).WithHandlerTimeout(time.Millisecond * 20)
+	defer e.Close()
+
+	e.Collect(-1)
+	time.Sleep(time.Millisecond * 10)
+	e.Collect(1)
+	e.Collect(2)
+	time.Sleep(time.Millisecond * 50)
+
+	if executed.Load() != 2 {
+		t.Errorf("超时后应该继续执行下一个批次, 实际执行 %d", executed.Load())
+	}
+	stats := e.Stats()
+	if stats.Abandoned != 1 || !errors.Is(stats.LastError, basic.ErrHandlerTimeout) {
+		t.Errorf("统计错误 %+v", stats)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	var executed atomic.Int32
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		executed.Add(1)
+	}).WithPeriodic(time.Hour)
+	defer e.Close()
+
+	e.Collect(1)
+	time.Sleep(time.Millisecond * 10)
+	e.Collect(2)
+	time.Sleep(time.Millisecond * 10)
+	if executed.Load() != 1 {
+		t.Fatalf("周期内应该只执行第一个批次, 实际 %d", executed.Load())
+	}
+
+	if _, err := e.Reconfigure(basic.Tuning{Periodic: time.Millisecond, BatchSize: 10}); err == nil {
+		t.Error("不支持的参数应该返回错误")
+	}
+	changes, err := e.Reconfigure(basic.Tuning{Periodic: time.Millisecond, RateLimit: &basic.RateLimit{Rate: 1000}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []basic.Change{
+		{Field: "rate_limit", Old: basic.RateLimit{}, New: basic.RateLimit{Rate: 1000, Burst: 1000}},
+		{Field: "periodic", Old: time.Hour, New: time.Millisecond},
+	}
+	if !reflect.DeepEqual(changes, want) {
+		t.Errorf("修改错误 %v", changes)
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	if executed.Load() != 2 {
+		t.Errorf("修改周期后应该立即按新周期执行, 实际 %d", executed.Load())
+	}
+
+	if changes, _ := e.Reconfigure(basic.Tuning{Periodic: time.Millisecond}); len(changes) != 0 {
+		t.Errorf("没有修改时不应该返回修改 %v", changes)
+	}
+}
+
+func TestReconfigureConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20)
+		running.Add(-1)
+	}).WithPeriodic(time.Millisecond).WithConcurrent(4)
+	defer e.Close()
+
+	if _, err := e.Reconfigure(basic.Tuning{Concurrency: 1}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		e.Collect(i)
+		time.Sleep(time.Millisecond * 2)
+	}
+	e.Flush(context.Background())
+
+	if peak.Load() != 1 {
+		t.Errorf("并发数修改为 1 后最多同时执行 1 个批次, 实际 %d", peak.Load())
+	}
+}
+
+func TestOrderedCommit(t *testing.T) {
+	const batches = 10
+
+	commits := make(chan []int, batches)
+	var seqs []uint64
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		// 后开始的批次先执行完
+		time.Sleep(time.Duration(batches-item) * time.Millisecond * 10)
+	}).WithPeriodic(time.Millisecond).WithConcurrent(batches).
+		WithOnCommit(func(seq uint64, items []int, err error) {
+			seqs = append(seqs, seq)
+			commits <- append([]int(nil), items...)
+		})
+	defer e.Close()
+
+	for i := 0; i < batches; i++ {
+		e.Collect(i)
+		time.Sleep(time.Millisecond * 2)
+	}
+
+	var committed []int
+	for len(committed) < batches {
+		select {
+		case items := <-commits:
+			committed = append(committed, items...)
+		case <-time.After(time.Second * 5):
+			t.Fatalf("等待提交超时, 已提交 %v", committed)
+		}
+	}
+	for i, item := range committed {
+		if item != i {
+			t.Fatalf("期望按收集的顺序提交, 实际 %v", committed)
+		}
+	}
+	for i, seq := range seqs {
+		if seq != uint64(i+1) {
+			t.Fatalf("期望序号连续递增, 实际 %v", seqs)
+		}
+	}
+}
+
+func TestCommitError(t *testing.T) {
+	errFail := errors.New("fail")
+
+	var mu sync.Mutex
+	commits := make(map[int]error)
+	e := periodic.NewConcurrentExecuteContext[int](func(ctx context.Context, item int) error {
+		if item%2 == 1 {
+			return errFail
+		}
+		return nil
+	}).WithPeriodic(time.Millisecond).WithConcurrent(2).
+		WithOnCommit(func(seq uint64, items []int, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, item := range items {
+				commits[item] = err
+			}
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i := 0; i < 4; i++ {
+		e.Submit(ctx, i)
+		// 每个数据一个批次
+		if err := e.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush 返回时批次已经提交, 不需要等待
+	mu.Lock()
+	defer mu.Unlock()
+	if len(commits) != 4 {
+		t.Fatalf("期望提交 4 个批次, 实际 %v", commits)
+	}
+	for item, err := range commits {
+		if item%2 == 1 && !errors.Is(err, errFail) || item%2 == 0 && err != nil {
+			t.Errorf("数据 %d 期望以批次的错误提交, 实际 %v", item, err)
+		}
+	}
+}
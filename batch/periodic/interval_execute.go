@@ -1,12 +1,14 @@
 package periodic
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/utils"
 )
 
@@ -20,24 +22,43 @@ type executeIntervalSub[ITEM any] struct {
 	periodic atomic.Int64
 
 	// 要执行的函数
-	execDo func(item ITEM)
+	execDo func(ctx context.Context, item ITEM) error
 
 	loopExecuteOnce sync.Once
 	stopChan        chan struct{}
 	stopOnce        utils.OnceNoWait
-	itemsChan       chan ITEM
+	items           *basic.Queue[basic.Entry[ITEM]]
+	gate            basic.Gate
+
+	guard      basic.BreakerGuard[ITEM]
+	expiry     basic.Expiry[ITEM]
+	batches    basic.BatchPool[ITEM]
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[ITEM]
 }
 
 func NewExecuteInterval[ITEM any](execDo func(item ITEM)) *ExecuteInterval[ITEM] {
+	return NewExecuteIntervalContext(func(ctx context.Context, item ITEM) error {
+		execDo(item)
+		return nil
+	})
+}
+
+// NewExecuteIntervalContext 以带上下文的执行函数创建. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消,
+// 返回的错误合并为批次的错误
+func NewExecuteIntervalContext[ITEM any](execDo func(ctx context.Context, item ITEM) error) *ExecuteInterval[ITEM] {
 	e := &ExecuteInterval[ITEM]{
 		sub: &executeIntervalSub[ITEM]{
 			// periodic: time.Millisecond * 100,
-			itemsChan: make(chan ITEM, 1<<16),
-			execDo:    execDo,
+			stopChan: make(chan struct{}),
+			items:    basic.NewQueue[basic.Entry[ITEM]](1 << 16),
+			execDo:   execDo,
 		},
 	}
 	e.sub.periodic.Store(int64(time.Millisecond) * 100)
 
+	e.sub.monitor.SetKind("periodic.ExecuteInterval")
+	e.sub.monitor.SetState(basic.StateRunning)
 	e.loopExecute()
 
 	runtime.SetFinalizer(e, func(ee *ExecuteInterval[ITEM]) {
@@ -54,16 +75,205 @@ func (pe *ExecuteInterval[ITEM]) WithPeriodic(per time.Duration) *ExecuteInterva
 	return pe
 }
 
+// WithCircuitBreaker 设置熔断器. 熔断打开时按 policy 暂停消费或转入死信
+func (pe *ExecuteInterval[ITEM]) WithCircuitBreaker(cb *basic.CircuitBreaker, policy basic.BreakerPolicy) *ExecuteInterval[ITEM] {
+	pe.sub.guard.SetBreaker(cb, policy)
+	return pe
+}
+
+// WithDeadLetter 设置熔断打开时的死信处理函数, 只在 basic.BreakerDeadLetter 策略下生效. 函数收到数据的副本, panic 会被 recover
+func (pe *ExecuteInterval[ITEM]) WithDeadLetter(deadLetterDo func(items []ITEM)) *ExecuteInterval[ITEM] {
+	pe.sub.guard.SetDeadLetter(deadLetterDo)
+	return pe
+}
+
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (pe *ExecuteInterval[ITEM]) WithMetrics(metrics basic.Metrics) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetMetrics(metrics)
+	return pe
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (pe *ExecuteInterval[ITEM]) WithTracer(tracer basic.Tracer) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetTracer(tracer)
+	return pe
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (pe *ExecuteInterval[ITEM]) WithLogger(logger *slog.Logger) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetLogger(logger)
+	return pe
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (pe *ExecuteInterval[ITEM]) WithName(name string) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetName(name)
+	return pe
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (pe *ExecuteInterval[ITEM]) WithHooks(hooks basic.Hooks) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetHooks(hooks)
+	return pe
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (pe *ExecuteInterval[ITEM]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *ExecuteInterval[ITEM] {
+	pe.sub.middleware.Use(middlewares...)
+	return pe
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后取消 ctx, 批次以 basic.ErrHandlerTimeout 结束并继续执行下一个批次. 小于等于0不超时
+func (pe *ExecuteInterval[ITEM]) WithHandlerTimeout(d time.Duration) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetHandlerTimeout(d)
+	return pe
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach
+func (pe *ExecuteInterval[ITEM]) WithAbandonPolicy(policy basic.AbandonPolicy) *ExecuteInterval[ITEM] {
+	pe.sub.monitor.SetAbandonPolicy(policy)
+	return pe
+}
+
+// WithTTL 设置数据的存活时间, 从收集时开始计算, 过期的数据在执行前被丢弃. 小于等于0不过期
+func (pe *ExecuteInterval[ITEM]) WithTTL(ttl time.Duration) *ExecuteInterval[ITEM] {
+	pe.sub.expiry.SetTTL(ttl)
+	return pe
+}
+
+// WithOnExpired 设置过期数据的处理函数
+func (pe *ExecuteInterval[ITEM]) WithOnExpired(onExpiredDo func(item ITEM)) *ExecuteInterval[ITEM] {
+	pe.sub.expiry.SetOnExpired(onExpiredDo)
+	return pe
+}
+
+// WithRingBuffer 使用容量不小于 size 的无锁环形缓冲区代替通道作为数据队列, 容量向上取 2 的幂.
+// 多个协程高频收集时, 执行循环每次取走全部已写入的数据, 不需要逐个接收. 只有第一次调用生效
+func (pe *ExecuteInterval[ITEM]) WithRingBuffer(size int) *ExecuteInterval[ITEM] {
+	pe.sub.items.UseRing(size)
+	return pe
+}
+
 // Collect 收集数据
 func (exec *ExecuteInterval[ITEM]) Collect(item ITEM) {
-	exec.sub.itemsChan <- item
+	exec.collect(exec.sub.expiry.Entry(item))
+}
+
+// CollectContext 收集数据并携带上下文, 批次跨度会关联 ctx 中的跨度
+func (exec *ExecuteInterval[ITEM]) CollectContext(ctx context.Context, item ITEM) {
+	entry := exec.sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	exec.collect(entry)
+}
+
+// CollectWithTTL 收集数据并指定存活时间
+func (exec *ExecuteInterval[ITEM]) CollectWithTTL(item ITEM, ttl time.Duration) {
+	exec.CollectWithDeadline(item, time.Now().Add(ttl))
+}
+
+// CollectWithDeadline 收集数据并指定过期时间
+func (exec *ExecuteInterval[ITEM]) CollectWithDeadline(item ITEM, deadline time.Time) {
+	exec.collect(exec.sub.expiry.EntryWithDeadline(item, deadline))
+}
+
+func (exec *ExecuteInterval[ITEM]) collect(entry basic.Entry[ITEM]) {
+	if err := exec.sub.items.Put(entry); err != nil {
+		// 已关闭
+		return
+	}
+	exec.sub.monitor.Collected(1)
+	exec.sub.monitor.QueueDepth(exec.sub.items.Len())
+}
+
+// Submit 投递数据, 队列满时等待. 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err(). 批次跨度会关联 ctx 中的跨度
+func (exec *ExecuteInterval[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	sub := exec.sub
+	entry := sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	if err := sub.items.Send(&sub.gate, ctx, entry, sub.stopChan); err != nil {
+		return err
+	}
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(sub.items.Len())
+	return nil
+}
+
+// TrySubmit 投递数据, 队列满时返回 basic.ErrQueueFull
+func (exec *ExecuteInterval[ITEM]) TrySubmit(item ITEM) error {
+	sub := exec.sub
+	if err := sub.items.TrySend(&sub.gate, sub.expiry.Entry(item)); err != nil {
+		return err
+	}
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(sub.items.Len())
+	return nil
+}
+
+// Flush 等待已收集的数据全部执行或丢弃
+func (exec *ExecuteInterval[ITEM]) Flush(ctx context.Context) error {
+	return exec.sub.monitor.Flush(ctx, exec.sub.stopChan)
+}
+
+// Shutdown 停止接收 Submit, 等待已收集的数据执行完后关闭. ctx 结束时立即关闭并返回 ctx.Err()
+func (exec *ExecuteInterval[ITEM]) Shutdown(ctx context.Context) error {
+	exec.sub.gate.Close()
+	err := exec.Flush(ctx)
+	exec.Close()
+	return err
+}
+
+// Expired 过期丢弃的数量
+func (exec *ExecuteInterval[ITEM]) Expired() uint64 {
+	return exec.sub.expiry.Expired()
+}
+
+// Reconfigure 修改运行中的参数: 执行周期和限速. 参数都合法时全部生效, 否则都不生效. 返回实际的修改
+func (exec *ExecuteInterval[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	sub := exec.sub
+	changes, err := sub.monitor.Reconfigure(t, basic.TunePeriodic)
+	if err != nil {
+		return nil, err
+	}
+	if t.Periodic > 0 {
+		old := time.Duration(sub.periodic.Swap(int64(t.Periodic)))
+		changes = basic.Changed(changes, "periodic", old, t.Periodic)
+		sub.monitor.Wake()
+	}
+	return sub.monitor.Reconfigured(changes), nil
+}
+
+// Pause 暂停执行, 继续接收数据. 正在执行的批次执行完, 之后的批次等待到 Resume. 暂停中关闭时等待的批次被丢弃
+func (exec *ExecuteInterval[ITEM]) Pause() {
+	exec.sub.monitor.Pause()
+}
+
+// Resume 恢复执行
+func (exec *ExecuteInterval[ITEM]) Resume() {
+	exec.sub.monitor.Resume()
+}
+
+// Stats 运行状态的快照
+func (exec *ExecuteInterval[ITEM]) Stats() basic.Stats {
+	sub := exec.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = sub.items.Len()
+	stats.QueueCap = sub.items.Cap()
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (exec *ExecuteInterval[ITEM]) Settled() <-chan struct{} {
+	return exec.sub.monitor.Settled()
 }
 
 // Stop 停止执行
 func (exec *ExecuteInterval[ITEM]) Close() {
 	exec.sub.stopOnce.Do(func() {
+		exec.sub.monitor.SetState(basic.StateClosed)
+		exec.sub.monitor.Shutdown()
 		close(exec.sub.stopChan)
-		close(exec.sub.itemsChan)
+		exec.sub.gate.Close()
+		exec.sub.items.Close()
 	})
 
 }
@@ -74,55 +284,98 @@ func (exec *ExecuteInterval[ITEM]) loopExecute() {
 
 		go func() {
 
-			var items []ITEM
+			var entries []basic.Entry[ITEM]
 
 			for {
 				select {
 				case <-sub.stopChan:
-					// 收到停止信号，退出循环
+					// 收到停止信号，退出循环. 队列中剩下的数据计为丢弃
+					sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
 					return
-				case item := <-sub.itemsChan:
+				case entry, ok := <-sub.items.C():
+					if !ok {
+						// 已关闭
+						sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
+						return
+					}
 					// log.Println(" param := <-exec.params 1 ")
-					items = append(items, item)
-
-					func() {
-						for {
-
-							select {
-							case item := <-sub.itemsChan:
-								// log.Println(" param := <-exec.params 2 ")
-								items = append(items, item)
-							default:
-								func() {
-									if len(items) == 0 {
-										return
-									}
-									// recover保护
-									defer func() {
-										if ierr := recover(); ierr != nil {
-											log.Println(ierr)
-										}
-									}()
-
-									for _, item := range items {
-										sub.execDo(item)
-									}
-									items = items[:0]
-
-									periodic := time.Duration(sub.periodic.Load())
-									time.Sleep(periodic)
+					entries = append(entries, entry)
+				case <-sub.items.Ready():
+					// 环形缓冲区有数据, 在下面一起取出
+				}
 
-								}()
+				func() {
+					for {
+
+						select {
+						case entry, ok := <-sub.items.C():
+							if !ok {
+								sub.monitor.Dropped(len(entries), basic.ErrClosed)
+								entries = entries[:0]
 								return
 							}
-						}
+							// log.Println(" param := <-exec.params 2 ")
+							entries = append(entries, entry)
+						default:
+							entries = sub.items.Drain(entries)
+							if len(entries) == 0 {
+								// 没有取到数据
+								return
+							}
+							func() {
+								if len(entries) == 0 {
+									return
+								}
+								defer func() {
+									entries = entries[:0]
+								}()
 
-					}()
+								// 丢弃过期的数据
+								live := sub.expiry.Filter(&sub.monitor, entries)
+								sub.monitor.QueueDepth(sub.items.Len())
+								if len(live) == 0 {
+									return
+								}
+								batch := sub.batches.Get()
+								batch.Items = basic.ItemsOf(live, batch.Items)
+								links := basic.SpanLinks(&sub.monitor, live)
 
-				}
+								release, err := sub.guard.Acquire(&sub.monitor, sub.stopChan, batch.Items)
+								if err != nil {
+									sub.monitor.Dropped(len(batch.Items), err)
+									sub.batches.Put(&sub.monitor, batch, nil)
+									return
+								}
+								err = sub.execute(links, batch.Items)
+								release(err)
+								sub.batches.Put(&sub.monitor, batch, err)
+
+								sub.monitor.Pace(time.Now(), &sub.periodic, sub.stopChan)
+
+							}()
+							if sub.items.Len() == 0 {
+								sub.monitor.Idle()
+							}
+							return
+						}
+					}
+
+				}()
 
 			}
 
 		}()
 	})
 }
+
+// execute 执行一个批次, panic 会被 recover 并转换为 error
+func (sub *executeIntervalSub[ITEM]) execute(links []basic.SpanContext, items []ITEM) error {
+	return sub.monitor.Execute(links, len(items), func(ctx context.Context) error {
+		return sub.middleware.Then(sub.handle)(ctx, items)
+	})
+}
+
+// handle 逐个执行数据, 是中间件链的最内层
+func (sub *executeIntervalSub[ITEM]) handle(ctx context.Context, items []ITEM) error {
+	return basic.HandleItems(ctx, items, sub.execDo)
+}
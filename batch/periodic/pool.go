@@ -0,0 +1,209 @@
+package periodic
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// PoolMode ConcurrentExecute 执行批次的方式
+type PoolMode int32
+
+const (
+	// PoolSpawn 每个批次启动一个协程执行, 默认
+	PoolSpawn PoolMode = iota
+	// PoolWorkStealing 每次取出的数据切分为子批次分配到各工作协程的队列, 空闲的工作协程从其他队列窃取.
+	// 数据的执行时间差别很大时, 一个批次不会只由一个协程执行
+	PoolWorkStealing
+	// PoolFixed 固定数量的长期运行的工作协程从任务通道取批次执行, 不为每个批次创建协程
+	PoolFixed
+)
+
+func (m PoolMode) String() string {
+	switch m {
+	case PoolSpawn:
+		return "spawn"
+	case PoolWorkStealing:
+		return "work-stealing"
+	case PoolFixed:
+		return "fixed"
+	default:
+		return "unknown"
+	}
+}
+
+// workerPool 长期运行的工作协程, stop 关闭后执行完已提交的任务再退出
+type workerPool interface {
+	submit(jobs []func())
+}
+
+// newWorkerPool 按 mode 创建 n 个工作协程的池, PoolSpawn 返回 nil
+func newWorkerPool(mode PoolMode, n int, stop <-chan struct{}) workerPool {
+	switch mode {
+	case PoolWorkStealing:
+		return newStealPool(n, stop)
+	case PoolFixed:
+		return newFixedPool(n, stop)
+	default:
+		return nil
+	}
+}
+
+// fixedPool 固定数量的工作协程从任务通道取任务
+type fixedPool struct {
+	jobs chan func()
+	stop <-chan struct{}
+}
+
+func newFixedPool(n int, stop <-chan struct{}) *fixedPool {
+	p := &fixedPool{
+		jobs: make(chan func(), n),
+		stop: stop,
+	}
+	for i := 0; i < n; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// submit 把任务放入任务通道. 执行循环保证未执行完的任务不超过工作协程数, 不会等待.
+// 已经停止时在当前协程执行
+func (p *fixedPool) submit(jobs []func()) {
+	for _, job := range jobs {
+		select {
+		case p.jobs <- job:
+		case <-p.stop:
+			job()
+		}
+	}
+}
+
+func (p *fixedPool) work() {
+	for {
+		select {
+		case job := <-p.jobs:
+			job()
+		case <-p.stop:
+			// 执行完剩下的任务再退出
+			for {
+				select {
+				case job := <-p.jobs:
+					job()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// stealPool 工作窃取池. 每个工作协程从自己队列的头部取任务, 自己的队列空了从其他队列的尾部窃取
+type stealPool struct {
+	deques []*deque
+	next   atomic.Uint32 // 轮流分配任务的起点
+	wake   chan struct{} // 有新任务的通知, 容量为工作协程数
+	stop   <-chan struct{}
+}
+
+func newStealPool(n int, stop <-chan struct{}) *stealPool {
+	p := &stealPool{
+		deques: make([]*deque, n),
+		wake:   make(chan struct{}, n),
+		stop:   stop,
+	}
+	for i := range p.deques {
+		p.deques[i] = &deque{}
+	}
+	for i := range p.deques {
+		go p.work(i)
+	}
+	return p
+}
+
+// submit 从下一个起点开始把任务轮流放入各工作协程的队列.
+// 已经停止时工作协程可能已经取完任务退出, 在当前协程执行队列中剩下的任务
+func (p *stealPool) submit(jobs []func()) {
+	start := int(p.next.Add(1))
+	for i, job := range jobs {
+		p.deques[(start+i)%len(p.deques)].pushBack(job)
+		select {
+		case p.wake <- struct{}{}:
+		default:
+		}
+	}
+
+	select {
+	case <-p.stop:
+		for job, ok := p.take(0); ok; job, ok = p.take(0) {
+			job()
+		}
+	default:
+	}
+}
+
+func (p *stealPool) work(i int) {
+	for {
+		if job, ok := p.take(i); ok {
+			job()
+			continue
+		}
+
+		select {
+		case <-p.wake:
+		case <-p.stop:
+			// 执行完剩下的任务再退出
+			for job, ok := p.take(i); ok; job, ok = p.take(i) {
+				job()
+			}
+			return
+		}
+	}
+}
+
+// take 先取自己的队列, 再依次窃取其他队列
+func (p *stealPool) take(i int) (func(), bool) {
+	if job, ok := p.deques[i].popFront(); ok {
+		return job, true
+	}
+	for k := 1; k < len(p.deques); k++ {
+		if job, ok := p.deques[(i+k)%len(p.deques)].popBack(); ok {
+			return job, true
+		}
+	}
+	return nil, false
+}
+
+// deque 工作协程的任务队列
+type deque struct {
+	mu   sync.Mutex
+	jobs []func()
+}
+
+func (d *deque) pushBack(job func()) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.jobs = append(d.jobs, job)
+}
+
+func (d *deque) popFront() (func(), bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.jobs) == 0 {
+		return nil, false
+	}
+	job := d.jobs[0]
+	d.jobs[0] = nil
+	d.jobs = d.jobs[1:]
+	return job, true
+}
+
+func (d *deque) popBack() (func(), bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.jobs) == 0 {
+		return nil, false
+	}
+	job := d.jobs[len(d.jobs)-1]
+	d.jobs[len(d.jobs)-1] = nil
+	d.jobs = d.jobs[:len(d.jobs)-1]
+	return job, true
+}
@@ -0,0 +1,283 @@
+package periodic_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+)
+
+// skewedCost 每 64 个数据有一个执行很慢
+func skewedCost(item int) {
+	if item%64 == 0 {
+		time.Sleep(time.Millisecond * 2)
+	}
+}
+
+func TestWorkStealing(t *testing.T) {
+	const n = 1024
+
+	var mu sync.Mutex
+	seen := make(map[int]int)
+	var committed []int
+
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		skewedCost(item)
+		mu.Lock()
+		seen[item]++
+		mu.Unlock()
+	}).WithPeriodic(time.Millisecond).WithConcurrent(4).WithPoolMode(periodic.PoolWorkStealing).
+		WithOnCommit(func(seq uint64, items []int, err error) {
+			mu.Lock()
+			committed = append(committed, items...)
+			mu.Unlock()
+		})
+	defer e.Close()
+
+	var terr *basic.TuningError
+	if _, err := e.Reconfigure(basic.Tuning{Concurrency: 8}); !errors.As(err, &terr) || terr.Field != "concurrency" {
+		t.Errorf("工作协程池期望不能修改并发数, 实际 %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		e.Submit(ctx, i)
+	}
+	if err := e.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Flush 等待最后的提交
+	mu.Lock()
+	defer mu.Unlock()
+
+	if len(seen) != n {
+		t.Fatalf("期望执行 %d 个数据, 实际 %d", n, len(seen))
+	}
+	for item, count := range seen {
+		if count != 1 {
+			t.Fatalf("数据 %d 执行了 %d 次", item, count)
+		}
+	}
+	if stats := e.Stats(); stats.Processed != n {
+		t.Errorf("统计错误 %+v", stats)
+	}
+	if len(committed) != n {
+		t.Fatalf("期望提交 %d 个数据, 实际 %d", n, len(committed))
+	}
+	for i, item := range committed {
+		if item != i {
+			t.Fatalf("子批次期望按顺序提交, 第 %d 个为 %d", i, item)
+		}
+	}
+}
+
+func benchmarkSkewed(b *testing.B, mode periodic.PoolMode) {
+	const items = 256
+
+	e := periodic.NewConcurrentExecute[int](skewedCost).
+		WithPeriodic(time.Millisecond).WithConcurrent(4).WithPoolMode(mode)
+	defer e.Close()
+
+	ctx := context.Background()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for item := 0; item < items; item++ {
+			e.Submit(ctx, item)
+		}
+		e.Flush(ctx)
+	}
+}
+
+// BenchmarkSkewed 执行时间不均匀时一轮数据全部执行完的时间
+func BenchmarkSkewed(b *testing.B) {
+	b.Run("spawn", func(b *testing.B) { benchmarkSkewed(b, periodic.PoolSpawn) })
+	b.Run("work-stealing", func(b *testing.B) { benchmarkSkewed(b, periodic.PoolWorkStealing) })
+}
+
+func TestFixedPool(t *testing.T) {
+	const n = 200
+
+	var count atomic.Int64
+	var running, peak atomic.Int32
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		r := running.Add(1)
+		for {
+			p := peak.Load()
+			if r <= p || peak.CompareAndSwap(p, r) {
+				break
+			}
+		}
+		time.Sleep(time.Microsecond * 100)
+		running.Add(-1)
+		count.Add(1)
+	}).WithPeriodic(time.Microsecond * 100).WithConcurrent(3).WithPoolMode(periodic.PoolFixed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		e.Submit(ctx, i)
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := count.Load(); c != n {
+		t.Errorf("期望执行 %d, 实际 %d", n, c)
+	}
+	if p := peak.Load(); p > 3 {
+		t.Errorf("期望最多 3 个工作协程同时执行, 实际 %d", p)
+	}
+}
+
+func TestFixedPoolConcurrent(t *testing.T) {
+	const n = 100
+
+	var count atomic.Int64
+	var running, peak atomic.Int32
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		r := running.Add(1)
+		for {
+			p := peak.Load()
+			if r <= p || peak.CompareAndSwap(p, r) {
+				break
+			}
+		}
+		time.Sleep(time.Microsecond * 100)
+		running.Add(-1)
+		count.Add(1)
+	}).WithPeriodic(time.Microsecond * 100).WithConcurrent(2).WithPoolMode(periodic.PoolFixed)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	e.Submit(ctx, 0)
+	if err := e.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// 工作协程池已经创建, 并发数固定为 2
+	e.WithConcurrent(8)
+	for i := 1; i < n; i++ {
+		e.Submit(ctx, i)
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := count.Load(); c != n {
+		t.Errorf("期望执行 %d, 实际 %d", n, c)
+	}
+	if p := peak.Load(); p > 2 {
+		t.Errorf("期望最多 2 个工作协程同时执行, 实际 %d", p)
+	}
+}
+
+func benchmarkSmallBatches(b *testing.B, mode periodic.PoolMode) {
+	done := make(chan struct{})
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		done <- struct{}{}
+	}).WithPeriodic(time.Microsecond).WithConcurrent(4).WithPoolMode(mode)
+	defer e.Close()
+
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.Submit(ctx, i)
+		<-done
+	}
+}
+
+// BenchmarkSmallBatches 周期很短, 每个批次只有一个数据时从投递到执行的延迟和每个批次的分配
+func BenchmarkSmallBatches(b *testing.B) {
+	b.Run("spawn", func(b *testing.B) { benchmarkSmallBatches(b, periodic.PoolSpawn) })
+	b.Run("fixed", func(b *testing.B) { benchmarkSmallBatches(b, periodic.PoolFixed) })
+}
+
+func TestConcurrentBatchOwnership(t *testing.T) {
+	const n = 2000
+
+	var count atomic.Int64
+	var corrupted atomic.Int32
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		count.Add(1)
+	}).WithPeriodic(time.Microsecond * 10).WithConcurrent(8).
+		WithMiddleware(func(next basic.BatchHandler[int]) basic.BatchHandler[int] {
+			return func(ctx context.Context, items []int) error {
+				// 执行中的批次不能被之后的批次覆盖
+				snapshot := append([]int(nil), items...)
+				time.Sleep(time.Microsecond * 200)
+				for i := range items {
+					if items[i] != snapshot[i] {
+						corrupted.Add(1)
+						break
+					}
+				}
+				return next(ctx, items)
+			}
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	for i := 0; i < n; i++ {
+		e.Submit(ctx, i)
+	}
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if c := corrupted.Load(); c != 0 {
+		t.Errorf("%d 个批次在执行中被覆盖", c)
+	}
+	if c := count.Load(); c != n {
+		t.Errorf("期望执行 %d, 实际 %d", n, c)
+	}
+}
+
+func TestConcurrentCloseWaiting(t *testing.T) {
+	for _, mode := range []periodic.PoolMode{periodic.PoolSpawn, periodic.PoolWorkStealing, periodic.PoolFixed} {
+		t.Run(mode.String(), func(t *testing.T) {
+			started := make(chan struct{})
+			block := make(chan struct{})
+			defer close(block)
+
+			e := periodic.NewConcurrentExecute[int](func(item int) {
+				if item == 0 {
+					close(started)
+					<-block
+				}
+			}).WithPeriodic(time.Millisecond).WithConcurrent(1).WithPoolMode(mode)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			e.Submit(ctx, 0)
+			<-started
+			// 执行循环取出第二个批次后等待空闲的并发数
+			e.Submit(ctx, 1)
+			time.Sleep(time.Millisecond * 20)
+
+			settled := e.Settled()
+			e.Close()
+			select {
+			case <-settled:
+			case <-ctx.Done():
+				t.Fatal("关闭时等待并发数的批次期望被丢弃")
+			}
+			if stats := e.Stats(); stats.Dropped != 1 {
+				t.Errorf("期望丢弃 1 个, 实际 %+v", stats)
+			}
+		})
+	}
+}
@@ -0,0 +1,484 @@
+package periodic
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/utils"
+)
+
+// PriorityStrategy 构建批次时从各优先级通道取数据的策略
+type PriorityStrategy int32
+
+const (
+	// StrictPriority 严格优先, 高优先级通道取空后才取低优先级通道
+	StrictPriority PriorityStrategy = iota
+	// WeightedFair 加权公平, 每轮按权重从各通道取数据, 低优先级也不会饿死
+	WeightedFair
+)
+
+// PriorityExecute 多优先级通道的间隔执行, priority 0 最高.
+// 每个批次最多 batchsize 个, 按策略从各通道构建批次, 批次之间间隔 periodic
+type PriorityExecute[ITEM any] struct {
+	sub *priorityExecuteSub[ITEM]
+}
+
+type priorityExecuteSub[ITEM any] struct {
+	periodic  atomic.Int64
+	batchsize atomic.Int64
+	strategy  atomic.Int32
+	weights   atomic.Pointer[[]int]
+
+	// 要执行的函数
+	execDo func(ctx context.Context, item ITEM) error
+
+	loopExecuteOnce sync.Once
+	stopChan        chan struct{}
+	stopOnce        utils.OnceNoWait
+	lanes           []*basic.Queue[basic.Entry[ITEM]]
+	gate            basic.Gate
+	signal          chan struct{} // 有数据到达的通知
+
+	guard      basic.BreakerGuard[ITEM]
+	expiry     basic.Expiry[ITEM]
+	batches    basic.BatchPool[ITEM]
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[ITEM]
+}
+
+// NewPriorityExecute lanes 为优先级通道数量, 小于1时为1.
+// 默认 batchsize 128 periodic 100ms, 严格优先
+func NewPriorityExecute[ITEM any](execDo func(item ITEM), lanes int) *PriorityExecute[ITEM] {
+	return NewPriorityExecuteContext(func(ctx context.Context, item ITEM) error {
+		execDo(item)
+		return nil
+	}, lanes)
+}
+
+// NewPriorityExecuteContext 以带上下文的执行函数创建. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消,
+// 返回的错误合并为批次的错误
+func NewPriorityExecuteContext[ITEM any](execDo func(ctx context.Context, item ITEM) error, lanes int) *PriorityExecute[ITEM] {
+	if lanes < 1 {
+		lanes = 1
+	}
+
+	e := &PriorityExecute[ITEM]{
+		sub: &priorityExecuteSub[ITEM]{
+			stopChan: make(chan struct{}),
+			signal:   make(chan struct{}, 1),
+			execDo:   execDo,
+		},
+	}
+
+	weights := make([]int, lanes)
+	for i := 0; i < lanes; i++ {
+		e.sub.lanes = append(e.sub.lanes, basic.NewQueue[basic.Entry[ITEM]](1<<16))
+		// 默认权重: 优先级越高权重越大
+		weights[i] = lanes - i
+	}
+	e.sub.weights.Store(&weights)
+	e.sub.periodic.Store(int64(time.Millisecond) * 100)
+	e.sub.batchsize.Store(128)
+
+	e.sub.monitor.SetKind("periodic.PriorityExecute")
+	e.sub.monitor.SetState(basic.StateRunning)
+	e.loopExecute()
+
+	runtime.SetFinalizer(e, func(ee *PriorityExecute[ITEM]) {
+		// 停止循环执行
+		ee.Close()
+	})
+
+	return e
+}
+
+func (pe *PriorityExecute[ITEM]) WithPeriodic(per time.Duration) *PriorityExecute[ITEM] {
+	pe.sub.periodic.Store(int64(per))
+	return pe
+}
+
+// WithBatchSize 每个批次的最大数量, 小于等于0不限制
+func (pe *PriorityExecute[ITEM]) WithBatchSize(bsize int) *PriorityExecute[ITEM] {
+	pe.sub.batchsize.Store(int64(bsize))
+	return pe
+}
+
+// WithStrategy 设置构建批次的策略
+func (pe *PriorityExecute[ITEM]) WithStrategy(strategy PriorityStrategy) *PriorityExecute[ITEM] {
+	pe.sub.strategy.Store(int32(strategy))
+	return pe
+}
+
+// WithWeights 设置 WeightedFair 策略下各通道每轮取数的权重, 缺省或小于1的权重按1处理
+func (pe *PriorityExecute[ITEM]) WithWeights(weights ...int) *PriorityExecute[ITEM] {
+	ws := make([]int, len(pe.sub.lanes))
+	for i := range ws {
+		ws[i] = 1
+		if i < len(weights) && weights[i] > 1 {
+			ws[i] = weights[i]
+		}
+	}
+	pe.sub.weights.Store(&ws)
+	return pe
+}
+
+// WithRingBuffer 每个优先级通道使用容量不小于 size 的无锁环形缓冲区代替通道, 容量向上取 2 的幂.
+// 构建批次时按策略一次从每个通道取走允许的数量. 只有第一次调用生效
+func (pe *PriorityExecute[ITEM]) WithRingBuffer(size int) *PriorityExecute[ITEM] {
+	for _, lane := range pe.sub.lanes {
+		lane.UseRing(size)
+	}
+	return pe
+}
+
+// WithCircuitBreaker 设置熔断器. 熔断打开时按 policy 暂停消费或转入死信
+func (pe *PriorityExecute[ITEM]) WithCircuitBreaker(cb *basic.CircuitBreaker, policy basic.BreakerPolicy) *PriorityExecute[ITEM] {
+	pe.sub.guard.SetBreaker(cb, policy)
+	return pe
+}
+
+// WithDeadLetter 设置熔断打开时的死信处理函数, 只在 basic.BreakerDeadLetter 策略下生效. 函数收到数据的副本, panic 会被 recover
+func (pe *PriorityExecute[ITEM]) WithDeadLetter(deadLetterDo func(items []ITEM)) *PriorityExecute[ITEM] {
+	pe.sub.guard.SetDeadLetter(deadLetterDo)
+	return pe
+}
+
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (pe *PriorityExecute[ITEM]) WithMetrics(metrics basic.Metrics) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetMetrics(metrics)
+	return pe
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (pe *PriorityExecute[ITEM]) WithTracer(tracer basic.Tracer) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetTracer(tracer)
+	return pe
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (pe *PriorityExecute[ITEM]) WithLogger(logger *slog.Logger) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetLogger(logger)
+	return pe
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (pe *PriorityExecute[ITEM]) WithName(name string) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetName(name)
+	return pe
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (pe *PriorityExecute[ITEM]) WithHooks(hooks basic.Hooks) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetHooks(hooks)
+	return pe
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (pe *PriorityExecute[ITEM]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *PriorityExecute[ITEM] {
+	pe.sub.middleware.Use(middlewares...)
+	return pe
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后取消 ctx, 批次以 basic.ErrHandlerTimeout 结束并继续执行下一个批次. 小于等于0不超时
+func (pe *PriorityExecute[ITEM]) WithHandlerTimeout(d time.Duration) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetHandlerTimeout(d)
+	return pe
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach
+func (pe *PriorityExecute[ITEM]) WithAbandonPolicy(policy basic.AbandonPolicy) *PriorityExecute[ITEM] {
+	pe.sub.monitor.SetAbandonPolicy(policy)
+	return pe
+}
+
+// WithTTL 设置数据的存活时间, 从收集时开始计算, 过期的数据在执行前被丢弃. 小于等于0不过期
+func (pe *PriorityExecute[ITEM]) WithTTL(ttl time.Duration) *PriorityExecute[ITEM] {
+	pe.sub.expiry.SetTTL(ttl)
+	return pe
+}
+
+// WithOnExpired 设置过期数据的处理函数
+func (pe *PriorityExecute[ITEM]) WithOnExpired(onExpiredDo func(item ITEM)) *PriorityExecute[ITEM] {
+	pe.sub.expiry.SetOnExpired(onExpiredDo)
+	return pe
+}
+
+// Collect 以最低优先级收集数据
+func (exec *PriorityExecute[ITEM]) Collect(item ITEM) {
+	exec.CollectWithPriority(item, len(exec.sub.lanes)-1)
+}
+
+// CollectWithPriority 按优先级收集数据, 0 最高. 超出范围的优先级会被截断到最近的通道
+func (exec *PriorityExecute[ITEM]) CollectWithPriority(item ITEM, prio int) {
+	exec.collect(exec.sub.expiry.Entry(item), prio)
+}
+
+// CollectWithPriorityContext 按优先级收集数据并携带上下文, 批次跨度会关联 ctx 中的跨度
+func (exec *PriorityExecute[ITEM]) CollectWithPriorityContext(ctx context.Context, item ITEM, prio int) {
+	entry := exec.sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	exec.collect(entry, prio)
+}
+
+// CollectWithPriorityDeadline 按优先级收集数据并指定过期时间
+func (exec *PriorityExecute[ITEM]) CollectWithPriorityDeadline(item ITEM, prio int, deadline time.Time) {
+	exec.collect(exec.sub.expiry.EntryWithDeadline(item, deadline), prio)
+}
+
+// Expired 过期丢弃的数量
+func (exec *PriorityExecute[ITEM]) Expired() uint64 {
+	return exec.sub.expiry.Expired()
+}
+
+// Reconfigure 修改运行中的参数: 执行周期, 批次数量和限速. 参数都合法时全部生效, 否则都不生效. 返回实际的修改
+func (exec *PriorityExecute[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	sub := exec.sub
+	changes, err := sub.monitor.Reconfigure(t, basic.TunePeriodic|basic.TuneBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if t.Periodic > 0 {
+		old := time.Duration(sub.periodic.Swap(int64(t.Periodic)))
+		changes = basic.Changed(changes, "periodic", old, t.Periodic)
+		sub.monitor.Wake()
+	}
+	if t.BatchSize > 0 {
+		old := int(sub.batchsize.Swap(int64(t.BatchSize)))
+		changes = basic.Changed(changes, "batch_size", old, t.BatchSize)
+	}
+	return sub.monitor.Reconfigured(changes), nil
+}
+
+// Pause 暂停执行, 继续接收数据. 正在执行的批次执行完, 之后的批次等待到 Resume. 暂停中关闭时等待的批次被丢弃
+func (exec *PriorityExecute[ITEM]) Pause() {
+	exec.sub.monitor.Pause()
+}
+
+// Resume 恢复执行
+func (exec *PriorityExecute[ITEM]) Resume() {
+	exec.sub.monitor.Resume()
+}
+
+// Stats 运行状态的快照
+func (exec *PriorityExecute[ITEM]) Stats() basic.Stats {
+	sub := exec.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = sub.queueLen()
+	stats.QueueCap = sub.queueCap()
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (exec *PriorityExecute[ITEM]) Settled() <-chan struct{} {
+	return exec.sub.monitor.Settled()
+}
+
+func (exec *PriorityExecute[ITEM]) collect(entry basic.Entry[ITEM], prio int) {
+	sub := exec.sub
+	if prio < 0 {
+		prio = 0
+	} else if prio >= len(sub.lanes) {
+		prio = len(sub.lanes) - 1
+	}
+
+	if err := sub.lanes[prio].Put(entry); err != nil {
+		// 已关闭
+		return
+	}
+	sub.collected()
+}
+
+// collected 记录收集并通知执行循环
+func (sub *priorityExecuteSub[ITEM]) collected() {
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(sub.queueLen())
+	select {
+	case sub.signal <- struct{}{}:
+	default:
+	}
+}
+
+// Submit 以最低优先级投递数据, 队列满时等待. 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err()
+func (exec *PriorityExecute[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	sub := exec.sub
+	entry := sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	if err := sub.lanes[len(sub.lanes)-1].Send(&sub.gate, ctx, entry, sub.stopChan); err != nil {
+		return err
+	}
+	sub.collected()
+	return nil
+}
+
+// TrySubmit 以最低优先级投递数据, 队列满时返回 basic.ErrQueueFull
+func (exec *PriorityExecute[ITEM]) TrySubmit(item ITEM) error {
+	sub := exec.sub
+	if err := sub.lanes[len(sub.lanes)-1].TrySend(&sub.gate, sub.expiry.Entry(item)); err != nil {
+		return err
+	}
+	sub.collected()
+	return nil
+}
+
+// Flush 等待已收集的数据全部执行或丢弃
+func (exec *PriorityExecute[ITEM]) Flush(ctx context.Context) error {
+	return exec.sub.monitor.Flush(ctx, exec.sub.stopChan)
+}
+
+// Shutdown 停止接收 Submit, 等待已收集的数据执行完后关闭. ctx 结束时立即关闭并返回 ctx.Err()
+func (exec *PriorityExecute[ITEM]) Shutdown(ctx context.Context) error {
+	exec.sub.gate.Close()
+	err := exec.Flush(ctx)
+	exec.Close()
+	return err
+}
+
+// Close 停止执行
+func (exec *PriorityExecute[ITEM]) Close() {
+	exec.sub.stopOnce.Do(func() {
+		exec.sub.monitor.SetState(basic.StateClosed)
+		exec.sub.monitor.Shutdown()
+		close(exec.sub.stopChan)
+		exec.sub.gate.Close()
+		for _, lane := range exec.sub.lanes {
+			lane.Close()
+		}
+	})
+}
+
+func (exec *PriorityExecute[ITEM]) loopExecute() {
+	sub := exec.sub
+	sub.loopExecuteOnce.Do(func() {
+
+		go func() {
+
+			var entries []basic.Entry[ITEM]
+
+			for {
+				select {
+				case <-sub.stopChan:
+					// 收到停止信号，退出循环. 队列中剩下的数据计为丢弃
+					sub.discard()
+					return
+				case <-sub.signal:
+				}
+
+				// 一直处理到所有通道为空, 每个批次都重新按优先级构建
+				for {
+					select {
+					case <-sub.stopChan:
+						sub.discard()
+						return
+					default:
+					}
+
+					entries = sub.drain(entries[:0])
+					if len(entries) == 0 {
+						sub.monitor.Idle()
+						break
+					}
+
+					// 丢弃过期的数据
+					live := sub.expiry.Filter(&sub.monitor, entries)
+					sub.monitor.QueueDepth(sub.queueLen())
+					if len(live) == 0 {
+						continue
+					}
+					batch := sub.batches.Get()
+					batch.Items = basic.ItemsOf(live, batch.Items)
+					links := basic.SpanLinks(&sub.monitor, live)
+
+					release, err := sub.guard.Acquire(&sub.monitor, sub.stopChan, batch.Items)
+					if err != nil {
+						sub.monitor.Dropped(len(batch.Items), err)
+						sub.batches.Put(&sub.monitor, batch, nil)
+						continue
+					}
+					err = sub.execute(links, batch.Items)
+					release(err)
+					sub.batches.Put(&sub.monitor, batch, err)
+
+					sub.monitor.Pace(time.Now(), &sub.periodic, sub.stopChan)
+				}
+			}
+
+		}()
+	})
+}
+
+// drain 按策略从各通道取数据构建一个批次
+func (sub *priorityExecuteSub[ITEM]) drain(entries []basic.Entry[ITEM]) []basic.Entry[ITEM] {
+	limit := int(sub.batchsize.Load())
+	// room 批次还能放入的数量, 最多 n 个
+	room := func(n int) int {
+		if limit <= 0 {
+			return n
+		}
+		return min(n, limit-len(entries))
+	}
+
+	switch PriorityStrategy(sub.strategy.Load()) {
+	case WeightedFair:
+		weights := *sub.weights.Load()
+		for room(1) > 0 {
+			taken := len(entries)
+			for i, lane := range sub.lanes {
+				entries = lane.Take(entries, room(weights[i]))
+			}
+			if len(entries) == taken {
+				break
+			}
+		}
+	default:
+		for _, lane := range sub.lanes {
+			entries = lane.Take(entries, room(math.MaxInt))
+		}
+	}
+
+	return entries
+}
+
+// discard 等待 Close 关闭通道后取出剩下的数据, 计为丢弃
+func (sub *priorityExecuteSub[ITEM]) discard() {
+	n := 0
+	for _, lane := range sub.lanes {
+		n += lane.Discard()
+	}
+	sub.monitor.Dropped(n, basic.ErrClosed)
+}
+
+// queueCap 所有通道的容量
+func (sub *priorityExecuteSub[ITEM]) queueCap() int {
+	n := 0
+	for _, lane := range sub.lanes {
+		n += lane.Cap()
+	}
+	return n
+}
+
+// queueLen 所有通道中等待的数据量
+func (sub *priorityExecuteSub[ITEM]) queueLen() int {
+	n := 0
+	for _, lane := range sub.lanes {
+		n += lane.Len()
+	}
+	return n
+}
+
+// execute 执行一个批次, panic 会被 recover 并转换为 error
+func (sub *priorityExecuteSub[ITEM]) execute(links []basic.SpanContext, items []ITEM) error {
+	return sub.monitor.Execute(links, len(items), func(ctx context.Context) error {
+		return sub.middleware.Then(sub.handle)(ctx, items)
+	})
+}
+
+// handle 逐个执行数据, 是中间件链的最内层
+func (sub *priorityExecuteSub[ITEM]) handle(ctx context.Context, items []ITEM) error {
+	return basic.HandleItems(ctx, items, sub.execDo)
+}
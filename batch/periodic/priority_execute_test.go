@@ -0,0 +1,63 @@
+package periodic_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/batch/periodic"
+)
+
+// collectBlocked 先阻塞执行函数, 堆积数据后再放行, 返回执行顺序
+func collectBlocked(t *testing.T, strategy periodic.PriorityStrategy, weights ...int) []int {
+	var mu sync.Mutex
+	var order []int
+	block := make(chan struct{})
+
+	e := periodic.NewPriorityExecute[int](func(item int) {
+		if item == -1 {
+			<-block
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		order = append(order, item)
+	}, 2).WithPeriodic(time.Millisecond).WithBatchSize(4).WithStrategy(strategy).WithWeights(weights...)
+	defer e.Close()
+
+	e.CollectWithPriority(-1, 0)
+	time.Sleep(time.Millisecond * 20)
+
+	// 低优先级的积压
+	for i := 100; i < 106; i++ {
+		e.Collect(i)
+	}
+	// 紧急数据
+	e.CollectWithPriority(1, 0)
+	e.CollectWithPriority(2, 0)
+	e.CollectWithPriority(3, 0)
+
+	close(block)
+	time.Sleep(time.Millisecond * 100)
+
+	mu.Lock()
+	defer mu.Unlock()
+	return order
+}
+
+func TestPriorityStrict(t *testing.T) {
+	order := collectBlocked(t, periodic.StrictPriority)
+	expected := []int{1, 2, 3, 100, 101, 102, 103, 104, 105}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("期望执行顺序 %v, 实际 %v", expected, order)
+	}
+}
+
+func TestPriorityWeightedFair(t *testing.T) {
+	order := collectBlocked(t, periodic.WeightedFair, 1, 1)
+	expected := []int{1, 100, 2, 101, 3, 102, 103, 104, 105}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("期望执行顺序 %v, 实际 %v", expected, order)
+	}
+}
@@ -0,0 +1,131 @@
+package periodic_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+)
+
+type ringExecutor interface {
+	Collect(item int)
+	Flush(ctx context.Context) error
+	Stats() basic.Stats
+	Close()
+}
+
+func TestRingBuffer(t *testing.T) {
+	const producers, n = 8, 5000
+
+	var sum, count atomic.Int64
+	execDo := func(item int) {
+		sum.Add(int64(item))
+		count.Add(1)
+	}
+	executors := map[string]func() ringExecutor{
+		"interval": func() ringExecutor {
+			e := periodic.NewExecuteInterval[int](execDo).WithPeriodic(time.Millisecond)
+			// 切换前收集的数据在通道中, 同样执行
+			e.Collect(1)
+			return e.WithRingBuffer(1000)
+		},
+		"compensate": func() ringExecutor {
+			e := periodic.NewExecuteCompensate[int](execDo).WithPeriodic(time.Millisecond)
+			e.Collect(1)
+			return e.WithRingBuffer(1000)
+		},
+		"priority": func() ringExecutor {
+			e := periodic.NewPriorityExecute[int](execDo, 1).WithPeriodic(time.Millisecond).WithBatchSize(100)
+			e.Collect(1)
+			return e.WithRingBuffer(1000)
+		},
+		"concurrent": func() ringExecutor {
+			e := periodic.NewConcurrentExecute[int](execDo).WithPeriodic(time.Millisecond).WithConcurrent(4)
+			e.Collect(1)
+			return e.WithRingBuffer(1000)
+		},
+	}
+
+	for name, create := range executors {
+		t.Run(name, func(t *testing.T) {
+			sum.Store(0)
+			count.Store(0)
+			e := create()
+			defer e.Close()
+
+			if cap := e.Stats().QueueCap; cap != 1024 {
+				t.Errorf("期望队列容量 1024, 实际 %d", cap)
+			}
+
+			var wg sync.WaitGroup
+			for p := 0; p < producers; p++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 1; i <= n; i++ {
+						e.Collect(i)
+					}
+				}()
+			}
+			wg.Wait()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+			if err := e.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if count.Load() != producers*n+1 || sum.Load() != producers*n*(n+1)/2+1 {
+				t.Errorf("期望执行 %d 个, 实际 %d 个, 总和 %d", producers*n+1, count.Load(), sum.Load())
+			}
+		})
+	}
+}
+
+func TestRingBufferClose(t *testing.T) {
+	e := periodic.NewExecuteInterval[int](func(item int) {}).WithPeriodic(time.Millisecond).WithRingBuffer(1024)
+	e.Pause()
+	for i := 0; i < 100; i++ {
+		e.Collect(i)
+	}
+	e.Close()
+	// 执行循环退出时把环形缓冲区中剩下的数据计为丢弃
+	time.Sleep(time.Millisecond * 10)
+
+	if stats := e.Stats(); stats.Collected != 100 || stats.Processed != 0 || stats.Dropped != 100 {
+		t.Errorf("期望全部计为丢弃, 实际 %+v", stats)
+	}
+}
+
+func benchmarkCollect(b *testing.B, ring bool) {
+	var count atomic.Int64
+	e := periodic.NewConcurrentExecute[int](func(item int) {
+		count.Add(1)
+	}).WithPeriodic(time.Microsecond).WithConcurrent(4)
+	if ring {
+		e.WithRingBuffer(1 << 16)
+	}
+	defer e.Close()
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			e.Collect(1)
+		}
+	})
+	if err := e.Flush(context.Background()); err != nil {
+		b.Fatal(err)
+	}
+	if count.Load() != int64(b.N) {
+		b.Fatalf("期望执行 %d 个, 实际 %d", b.N, count.Load())
+	}
+}
+
+// BenchmarkCollect 多个协程收集到 ConcurrentExecute, 包括执行完的时间
+func BenchmarkCollect(b *testing.B) {
+	b.Run("channel", func(b *testing.B) { benchmarkCollect(b, false) })
+	b.Run("ring", func(b *testing.B) { benchmarkCollect(b, true) })
+}
@@ -0,0 +1,507 @@
+package threshold
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/utils"
+)
+
+// ErrResultMismatch 批次执行函数返回的结果数量和数据数量不一致
+var ErrResultMismatch = errors.New("result count does not match item count")
+
+// ItemErrors 批次中部分数据失败, 键为数据在 items 中的下标. 执行函数返回 ItemErrors 时只有这些数据的 Future
+// 是对应的错误, 其他数据照常返回结果. 批次仍计为失败
+type ItemErrors map[int]error
+
+func (e ItemErrors) Error() string {
+	indexes := e.indexes()
+	msgs := make([]string, len(indexes))
+	for i, index := range indexes {
+		msgs[i] = fmt.Sprintf("item %d: %v", index, e[index])
+	}
+	return fmt.Sprintf("%d items failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// Unwrap 按下标顺序返回各数据的错误
+func (e ItemErrors) Unwrap() []error {
+	indexes := e.indexes()
+	errs := make([]error, len(indexes))
+	for i, index := range indexes {
+		errs[i] = e[index]
+	}
+	return errs
+}
+
+func (e ItemErrors) indexes() []int {
+	indexes := make([]int, 0, len(e))
+	for index := range e {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes
+}
+
+// FutureExecute 阈值执行并返回每个数据的结果. 数量达到 batchsize 或周期到达时执行一个批次,
+// 执行函数返回和 items 一一对应的结果, 返回 error 时整个批次的 Future 都是这个错误, 返回 ItemErrors 时只有对应的数据失败.
+// 创建后自动启动, 默认 batchsize 128 periodic 100ms
+type FutureExecute[ITEM, R any] struct {
+	sub *futureExecuteSub[ITEM, R]
+}
+
+type futureExecuteSub[ITEM, R any] struct {
+	periodic  atomic.Int64
+	batchsize atomic.Int64
+
+	// 要执行的函数
+	execDo func(ctx context.Context, items []ITEM) ([]R, error)
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // 正在投递的 CollectAsync
+
+	stopChan  chan struct{}
+	stopOnce  utils.OnceNoWait
+	itemsChan chan futureItem[ITEM, R]
+	flushChan chan struct{} // Flush 的通知, 执行缓存的全部数据
+	resetChan chan struct{} // 修改周期的通知, 重新开始计时
+
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[ITEM]
+}
+
+type futureItem[ITEM, R any] struct {
+	ctx    context.Context
+	item   ITEM
+	future *basic.Future[R]
+}
+
+func NewFutureExecute[ITEM, R any](execDo func(items []ITEM) ([]R, error)) *FutureExecute[ITEM, R] {
+	return NewFutureExecuteContext(func(ctx context.Context, items []ITEM) ([]R, error) {
+		return execDo(items)
+	})
+}
+
+// NewFutureExecuteContext 以带上下文的执行函数创建. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消
+func NewFutureExecuteContext[ITEM, R any](execDo func(ctx context.Context, items []ITEM) ([]R, error)) *FutureExecute[ITEM, R] {
+	exec := &FutureExecute[ITEM, R]{
+		sub: &futureExecuteSub[ITEM, R]{
+			execDo:    execDo,
+			stopChan:  make(chan struct{}),
+			itemsChan: make(chan futureItem[ITEM, R], 1<<10),
+			flushChan: make(chan struct{}, 1),
+			resetChan: make(chan struct{}, 1),
+		},
+	}
+	exec.sub.periodic.Store(int64(time.Millisecond * 100))
+	exec.sub.batchsize.Store(128)
+
+	exec.sub.monitor.SetKind("threshold.FutureExecute")
+	exec.sub.monitor.SetState(basic.StateRunning)
+	go exec.sub.loopExecute()
+
+	runtime.SetFinalizer(exec, func(ee *FutureExecute[ITEM, R]) {
+		// 停止循环执行
+		ee.Close()
+	})
+
+	return exec
+}
+
+func (pe *FutureExecute[ITEM, R]) WithBatchSize(bsize int) *FutureExecute[ITEM, R] {
+	pe.sub.batchsize.Store(int64(bsize))
+	return pe
+}
+
+// WithPeriodic 设置周期, 运行中修改会重新开始计时
+func (pe *FutureExecute[ITEM, R]) WithPeriodic(per time.Duration) *FutureExecute[ITEM, R] {
+	pe.sub.periodic.Store(int64(per))
+	pe.sub.resetPeriodic()
+	return pe
+}
+
+// Reconfigure 修改运行中的参数: 周期, 批次数量和限速. 修改周期会重新开始计时.
+// 参数都合法时全部生效, 否则都不生效. 返回实际的修改
+func (pe *FutureExecute[ITEM, R]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	sub := pe.sub
+	changes, err := sub.monitor.Reconfigure(t, basic.TunePeriodic|basic.TuneBatchSize)
+	if err != nil {
+		return nil, err
+	}
+	if t.BatchSize > 0 {
+		old := int(sub.batchsize.Swap(int64(t.BatchSize)))
+		changes = basic.Changed(changes, "batch_size", old, t.BatchSize)
+	}
+	if t.Periodic > 0 {
+		old := time.Duration(sub.periodic.Swap(int64(t.Periodic)))
+		changes = basic.Changed(changes, "periodic", old, t.Periodic)
+		sub.resetPeriodic()
+	}
+	return sub.monitor.Reconfigured(changes), nil
+}
+
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (pe *FutureExecute[ITEM, R]) WithMetrics(metrics basic.Metrics) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetMetrics(metrics)
+	return pe
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (pe *FutureExecute[ITEM, R]) WithTracer(tracer basic.Tracer) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetTracer(tracer)
+	return pe
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (pe *FutureExecute[ITEM, R]) WithLogger(logger *slog.Logger) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetLogger(logger)
+	return pe
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (pe *FutureExecute[ITEM, R]) WithName(name string) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetName(name)
+	return pe
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (pe *FutureExecute[ITEM, R]) WithHooks(hooks basic.Hooks) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetHooks(hooks)
+	return pe
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (pe *FutureExecute[ITEM, R]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *FutureExecute[ITEM, R] {
+	pe.sub.middleware.Use(middlewares...)
+	return pe
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后整个批次的 Future 返回 basic.ErrHandlerTimeout 并继续执行下一个批次.
+// 小于等于0不超时
+func (pe *FutureExecute[ITEM, R]) WithHandlerTimeout(d time.Duration) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetHandlerTimeout(d)
+	return pe
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach.
+// 被放弃的执行函数之后返回的结果不再分发
+func (pe *FutureExecute[ITEM, R]) WithAbandonPolicy(policy basic.AbandonPolicy) *FutureExecute[ITEM, R] {
+	pe.sub.monitor.SetAbandonPolicy(policy)
+	return pe
+}
+
+// CollectAsync 收集数据, 返回该数据的执行结果. 已关闭时 Future 的错误为 basic.ErrClosed
+func (exec *FutureExecute[ITEM, R]) CollectAsync(item ITEM) *basic.Future[R] {
+	return exec.CollectAsyncContext(context.Background(), item)
+}
+
+// CollectAsyncContext 收集数据并携带上下文, 批次跨度会关联 ctx 中的跨度
+func (exec *FutureExecute[ITEM, R]) CollectAsyncContext(ctx context.Context, item ITEM) *basic.Future[R] {
+	fi := futureItem[ITEM, R]{ctx: ctx, item: item, future: basic.NewFuture[R]()}
+	if err := exec.sub.submit(fi, nil, true); err != nil {
+		var zero R
+		fi.future.Resolve(zero, err)
+	}
+	return fi.future
+}
+
+// Submit 收集数据, 不关心结果. 队列满时等待, 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err()
+func (exec *FutureExecute[ITEM, R]) Submit(ctx context.Context, item ITEM) error {
+	fi := futureItem[ITEM, R]{ctx: ctx, item: item, future: basic.NewFuture[R]()}
+	return exec.sub.submit(fi, ctx.Done(), true)
+}
+
+// TrySubmit 收集数据, 不关心结果. 队列满时返回 basic.ErrQueueFull
+func (exec *FutureExecute[ITEM, R]) TrySubmit(item ITEM) error {
+	fi := futureItem[ITEM, R]{ctx: context.Background(), item: item, future: basic.NewFuture[R]()}
+	return exec.sub.submit(fi, nil, false)
+}
+
+// Flush 立即执行缓存的数据, 不等待 batchsize 或周期, 并等待调用前收集的数据全部执行完
+func (exec *FutureExecute[ITEM, R]) Flush(ctx context.Context) error {
+	select {
+	case exec.sub.flushChan <- struct{}{}:
+	default:
+	}
+	return exec.sub.monitor.Flush(ctx, exec.sub.stopChan)
+}
+
+// Shutdown 停止接收数据, 执行完已收集的数据后关闭. ctx 结束时立即关闭,
+// 未执行的数据的 Future 返回 basic.ErrClosed, Shutdown 返回 ctx.Err()
+func (exec *FutureExecute[ITEM, R]) Shutdown(ctx context.Context) error {
+	exec.sub.mu.Lock()
+	exec.sub.closed = true
+	exec.sub.mu.Unlock()
+
+	err := exec.Flush(ctx)
+	exec.Close()
+	return err
+}
+
+// Pause 暂停执行, 继续接收数据. 正在执行的批次执行完, 之后的批次等待到 Resume. 暂停中关闭时 Future 返回 basic.ErrClosed
+func (exec *FutureExecute[ITEM, R]) Pause() {
+	exec.sub.monitor.Pause()
+}
+
+// Resume 恢复执行
+func (exec *FutureExecute[ITEM, R]) Resume() {
+	exec.sub.monitor.Resume()
+}
+
+// Stats 运行状态的快照
+func (exec *FutureExecute[ITEM, R]) Stats() basic.Stats {
+	sub := exec.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = len(sub.itemsChan)
+	stats.QueueCap = cap(sub.itemsChan)
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (exec *FutureExecute[ITEM, R]) Settled() <-chan struct{} {
+	return exec.sub.monitor.Settled()
+}
+
+// submit 投递到队列. wait 为 false 时队列满返回 basic.ErrQueueFull, done 关闭时返回 fi.ctx.Err()
+func (sub *futureExecuteSub[ITEM, R]) submit(fi futureItem[ITEM, R], done <-chan struct{}, wait bool) error {
+	sub.mu.Lock()
+	if sub.closed {
+		sub.mu.Unlock()
+		return basic.ErrClosed
+	}
+	sub.inflight.Add(1)
+	sub.mu.Unlock()
+	defer sub.inflight.Done()
+
+	if !wait {
+		select {
+		case sub.itemsChan <- fi:
+			sub.collected()
+			return nil
+		default:
+			return basic.ErrQueueFull
+		}
+	}
+
+	select {
+	case sub.itemsChan <- fi:
+		sub.collected()
+		return nil
+	case <-sub.stopChan:
+		return basic.ErrClosed
+	case <-done:
+		return fi.ctx.Err()
+	}
+}
+
+func (sub *futureExecuteSub[ITEM, R]) collected() {
+	sub.monitor.Collected(1)
+	sub.monitor.QueueDepth(len(sub.itemsChan))
+}
+
+// Close 停止执行, 未执行的数据的 Future 返回 basic.ErrClosed
+func (exec *FutureExecute[ITEM, R]) Close() {
+	exec.sub.stopOnce.Do(func() {
+		exec.sub.mu.Lock()
+		exec.sub.closed = true
+		exec.sub.mu.Unlock()
+
+		exec.sub.monitor.SetState(basic.StateClosed)
+		close(exec.sub.stopChan)
+	})
+}
+
+func (sub *futureExecuteSub[ITEM, R]) loopExecute() {
+	var batch []futureItem[ITEM, R]
+
+	timer := time.NewTimer(time.Duration(sub.periodic.Load()))
+	defer timer.Stop()
+
+	for {
+		// 优先处理停止信号
+		select {
+		case <-sub.stopChan:
+			sub.shutdown(batch)
+			return
+		default:
+		}
+
+		select {
+		case <-sub.stopChan:
+			sub.shutdown(batch)
+			return
+
+		case fi := <-sub.itemsChan:
+			batch = append(batch, fi)
+			if len(batch) >= int(sub.batchsize.Load()) {
+				sub.execute(batch)
+				batch = batch[:0]
+				sub.idle()
+				resetTimer(timer, time.Duration(sub.periodic.Load()))
+			}
+
+		case <-sub.resetChan:
+			resetTimer(timer, time.Duration(sub.periodic.Load()))
+
+		case <-sub.flushChan:
+			batch = sub.flush(batch)
+			resetTimer(timer, time.Duration(sub.periodic.Load()))
+
+		case <-timer.C:
+			if len(batch) != 0 {
+				sub.execute(batch)
+				batch = batch[:0]
+				sub.idle()
+			}
+			timer.Reset(time.Duration(sub.periodic.Load()))
+		}
+	}
+}
+
+// flush 执行缓存和队列中的全部数据, 每个批次不超过 batchsize. 队列取空后返回
+func (sub *futureExecuteSub[ITEM, R]) flush(batch []futureItem[ITEM, R]) []futureItem[ITEM, R] {
+	for {
+		size := int(sub.batchsize.Load())
+	fill:
+		for len(batch) < size {
+			select {
+			case fi := <-sub.itemsChan:
+				batch = append(batch, fi)
+			default:
+				break fill
+			}
+		}
+
+		if len(batch) != 0 {
+			sub.execute(batch)
+		}
+		if len(batch) < size {
+			sub.idle()
+			return batch[:0]
+		}
+		batch = batch[:0]
+	}
+}
+
+// shutdown 等待正在投递的数据, 然后全部返回关闭错误
+func (sub *futureExecuteSub[ITEM, R]) shutdown(batch []futureItem[ITEM, R]) {
+	sub.inflight.Wait()
+	for drained := false; !drained; {
+		select {
+		case fi := <-sub.itemsChan:
+			batch = append(batch, fi)
+		default:
+			drained = true
+		}
+	}
+
+	sub.monitor.Dropped(len(batch), basic.ErrClosed)
+	sub.monitor.Shutdown()
+
+	var zero R
+	for _, fi := range batch {
+		fi.future.Resolve(zero, basic.ErrClosed)
+	}
+}
+
+// resetPeriodic 通知执行循环按新的周期重新计时
+func (sub *futureExecuteSub[ITEM, R]) resetPeriodic() {
+	select {
+	case sub.resetChan <- struct{}{}:
+	default:
+	}
+}
+
+// idle 执行完批次后队列为空, 通知进入空闲
+func (sub *futureExecuteSub[ITEM, R]) idle() {
+	if len(sub.itemsChan) == 0 {
+		sub.monitor.Idle()
+	}
+}
+
+// execute 执行一个批次并分发结果, panic 会被 recover 并作为整个批次的错误. 执行函数返回 ItemErrors 时按数据分发错误
+func (sub *futureExecuteSub[ITEM, R]) execute(batch []futureItem[ITEM, R]) {
+	items := make([]ITEM, len(batch))
+	ctxs := make([]context.Context, len(batch))
+	for i, fi := range batch {
+		items[i] = fi.item
+		ctxs[i] = fi.ctx
+	}
+
+	var result futureResult[R]
+	err := sub.monitor.Execute(basic.ContextLinks(&sub.monitor, ctxs...), len(items), func(ctx context.Context) error {
+		return sub.middleware.Then(func(ctx context.Context, items []ITEM) error {
+			results, err := sub.execDo(ctx, items)
+			result.set(results)
+			return err
+		})(ctx, items)
+	})
+	results := result.seal()
+
+	// 部分失败时先按数据分发各自的错误, 结果数量不一致只影响没有错误的数据
+	var itemErrs ItemErrors
+	if errors.As(err, &itemErrs) {
+		err = nil
+	}
+	var mismatch error
+	if err == nil && len(results) != len(batch) {
+		mismatch = fmt.Errorf("%w: %d results for %d items", ErrResultMismatch, len(results), len(batch))
+	}
+
+	var zero R
+	for i, fi := range batch {
+		switch {
+		case err != nil:
+			fi.future.Resolve(zero, err)
+		case itemErrs[i] != nil:
+			fi.future.Resolve(zero, itemErrs[i])
+		case mismatch != nil:
+			fi.future.Resolve(zero, mismatch)
+		default:
+			fi.future.Resolve(results[i], nil)
+		}
+	}
+}
+
+// futureResult 一个批次的结果. 超时被放弃的 execDo 可能在分发之后才返回, 分发前封存, 之后不再写入
+type futureResult[R any] struct {
+	mu      sync.Mutex
+	results []R
+	sealed  bool
+}
+
+func (r *futureResult[R]) set(results []R) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.sealed {
+		r.results = results
+	}
+}
+
+// seal 封存并返回结果
+func (r *futureResult[R]) seal() []R {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sealed = true
+	return r.results
+}
+
+// resetTimer 停止并清空定时器后重新计时
+func resetTimer(timer *time.Timer, d time.Duration) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+	timer.Reset(d)
+}
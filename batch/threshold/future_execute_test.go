@@ -0,0 +1,203 @@
+package threshold_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/threshold"
+)
+
+func TestFutureExecute(t *testing.T) {
+	var batches atomic.Int32
+
+	e := threshold.NewFutureExecute(func(items []int) ([]string, error) {
+		batches.Add(1)
+		results := make([]string, len(items))
+		for i, item := range items {
+			if item%2 == 0 {
+				results[i] = "even"
+			} else {
+				results[i] = "odd"
+			}
+		}
+		return results, nil
+	}).WithBatchSize(10).WithPeriodic(time.Millisecond * 20)
+	defer e.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			result, err := e.CollectAsync(i).Await(ctx)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if (i%2 == 0) != (result == "even") {
+				t.Errorf("数据 %d 的结果错误: %s", i, result)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// 两个满批次和一个周期批次
+	if batches.Load() != 3 {
+		t.Errorf("期望执行 3 个批次, 实际 %d", batches.Load())
+	}
+}
+
+func TestFutureExecuteError(t *testing.T) {
+	e := threshold.NewFutureExecute(func(items []int) ([]int, error) {
+		if items[0] == 0 {
+			return nil, errors.New("batch failed")
+		}
+		if items[0] == 1 {
+			panic("boom")
+		}
+		return []int{}, nil
+	}).WithBatchSize(1)
+	defer e.Close()
+
+	ctx := context.Background()
+	if _, err := e.CollectAsync(0).Await(ctx); err == nil || err.Error() != "batch failed" {
+		t.Errorf("期望批次错误, 实际 %v", err)
+	}
+
+	var perr *basic.PanicError
+	if _, err := e.CollectAsync(1).Await(ctx); !errors.As(err, &perr) {
+		t.Errorf("期望 PanicError, 实际 %v", err)
+	}
+
+	if _, err := e.CollectAsync(2).Await(ctx); !errors.Is(err, threshold.ErrResultMismatch) {
+		t.Errorf("期望 ErrResultMismatch, 实际 %v", err)
+	}
+}
+
+func TestFutureExecuteClose(t *testing.T) {
+	block := make(chan struct{})
+	e := threshold.NewFutureExecute(func(items []int) ([]int, error) {
+		<-block
+		return items, nil
+	}).WithBatchSize(1)
+
+	first := e.CollectAsync(1)
+	time.Sleep(time.Millisecond * 10)
+	pending := e.CollectAsync(2)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := pending.Await(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望等待超时, 实际 %v", err)
+	}
+
+	e.Close()
+	close(block)
+
+	if v, err := first.Await(context.Background()); err != nil || v != 1 {
+		t.Errorf("执行中的数据应该正常返回, 实际 %v %v", v, err)
+	}
+	if _, err := pending.Await(context.Background()); !errors.Is(err, basic.ErrClosed) {
+		t.Errorf("期望 ErrClosed, 实际 %v", err)
+	}
+	if _, err := e.CollectAsync(3).Await(context.Background()); !errors.Is(err, basic.ErrClosed) {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+}
+
+func TestFutureExecutePartial(t *testing.T) {
+	errOdd := errors.New("odd item")
+	var seen atomic.Int32
+	e := threshold.NewFutureExecute(func(items []int) ([]int, error) {
+		results := make([]int, len(items))
+		errs := threshold.ItemErrors{}
+		for i, item := range items {
+			if item%2 == 1 {
+				errs[i] = errOdd
+				continue
+			}
+			results[i] = item * 10
+		}
+		return results, errs
+	}).WithBatchSize(4).WithMiddleware(func(next basic.BatchHandler[int]) basic.BatchHandler[int] {
+		return func(ctx context.Context, items []int) error {
+			seen.Add(int32(len(items)))
+			return next(ctx, items)
+		}
+	})
+	defer e.Close()
+
+	futures := make([]*basic.Future[int], 4)
+	for i := range futures {
+		futures[i] = e.CollectAsync(i)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	for i, f := range futures {
+		result, err := f.Await(ctx)
+		if i%2 == 1 {
+			if !errors.Is(err, errOdd) {
+				t.Errorf("数据 %d 期望自己的错误, 实际 %v", i, err)
+			}
+			continue
+		}
+		if err != nil || result != i*10 {
+			t.Errorf("数据 %d 期望结果 %d, 实际 %d %v", i, i*10, result, err)
+		}
+	}
+	if seen.Load() != 4 {
+		t.Errorf("期望中间件经过 4 个数据, 实际 %d", seen.Load())
+	}
+}
+
+func TestFutureExecuteTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+	e := threshold.NewFutureExecuteContext(func(ctx context.Context, items []int) ([]int, error) {
+		if items[0] == 0 {
+			<-block
+			return items, nil
+		}
+		return items, nil
+	}).WithBatchSize(1).WithHandlerTimeout(time.Millisecond * 20)
+	defer e.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := e.CollectAsync(0).Await(ctx); !errors.Is(err, basic.ErrHandlerTimeout) {
+		t.Errorf("期望 ErrHandlerTimeout, 实际 %v", err)
+	}
+	// 超时后继续执行下一个批次
+	if result, err := e.CollectAsync(1).Await(ctx); err != nil || result != 1 {
+		t.Errorf("期望结果 1, 实际 %d %v", result, err)
+	}
+}
+
+func TestFutureExecutePartialNoResults(t *testing.T) {
+	errItem := errors.New("item failed")
+	e := threshold.NewFutureExecute(func(items []int) ([]int, error) {
+		// 只返回部分失败, 没有结果
+		return nil, threshold.ItemErrors{0: errItem}
+	}).WithBatchSize(2)
+	defer e.Close()
+
+	f0, f1 := e.CollectAsync(0), e.CollectAsync(1)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := f0.Await(ctx); !errors.Is(err, errItem) {
+		t.Errorf("期望自己的错误, 实际 %v", err)
+	}
+	if _, err := f1.Await(ctx); !errors.Is(err, threshold.ErrResultMismatch) {
+		t.Errorf("没有结果的数据期望 ErrResultMismatch, 实际 %v", err)
+	}
+}
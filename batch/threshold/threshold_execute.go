@@ -1,98 +1,397 @@
 package threshold
 
 import (
+	"context"
+	"errors"
+	"log/slog"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/474420502/execute/basic"
 )
 
+// ErrStopped 执行器已 Stop, 重新调用 AsyncExecute 后才能继续收集数据
+var ErrStopped = errors.New("executor stopped")
+
+// defaultCapacity 默认缓存的数据上限
+const defaultCapacity = 1 << 16
+
 // ThresholdExecute 阈值执行, 超过阈值就执行. 必须调用AsyncExecute才能执行.
 // 默认 batchsize 128 periodic 100ms
+//
+// 状态: 创建 -> AsyncExecute -> 运行中 -> Stop -> 停止中 -> 已停止 -> AsyncExecute -> 运行中.
+// 创建后可以先收集数据, 停止中和已停止拒绝收集, Shutdown 后关闭, 不能再运行
 type ThresholdExecute[ITEM any] struct {
-	periodic  time.Duration //  时间
-	batchsize int           // batch的数量
+	periodic   time.Duration //  时间
+	batchsize  int           // batch的数量
+	maxPending int           // 等待执行的批次上限
+	capacity   int           // 缓存的数据上限, 包括等待执行的批次
+	concurrent int           // 同时执行的批次数
 
-	once *sync.Once
+	lifecycle sync.Mutex    // 串行 AsyncExecute 和 Stop
+	run       *thresholdRun // 当前的执行循环, 没有运行时为 nil
+	draining  sync.Mutex    // 串行 drain, 批次按取出的顺序编号和开始
 
-	sizeSignal chan []ITEM
+	running    atomic.Int64   // 正在执行的批次数
+	workerDone chan struct{}  // 批次执行完的通知
+	workers    sync.WaitGroup // 并发执行中的批次
+	committer  basic.Committer[ITEM]
 
 	itemSizeDo     func(i int, item ITEM)
 	itemPeriodicDo func(i int, item ITEM)
 	itemDo         func(i int, item ITEM)
-
-	recoverDo  func(ierr any)
-	stopSignal chan struct{}
-
-	items []ITEM
-	mu    sync.Mutex
+	execDo         func(ctx context.Context, item ITEM) error // NewThresholdExecuteContext 的执行函数, 没有设置 itemDo 时使用
+
+	recoverDo   func(ierr any)
+	resetSignal chan struct{} // 修改周期后重置计时
+	readySignal chan struct{} // 有等待执行的批次或 Flush, 通知执行循环
+
+	items    []ITEM               // 正在收集的数据
+	ctxs     []context.Context    // 与 items 一一对应的收集时的上下文
+	pending  []pendingBatch[ITEM] // 达到 batchsize 等待执行的批次
+	flushing bool                 // Flush 要求执行循环执行正在收集的数据
+	space    chan struct{}        // 有收集方等待空位时创建, 执行循环取走数据后关闭
+	mu       sync.Mutex
+	closed   bool // Shutdown 后不再接收 Submit
+
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[ITEM]
 }
 
 func NewThresholdExecute[ITEM any](itemDo func(i int, item ITEM)) *ThresholdExecute[ITEM] {
 	exec := &ThresholdExecute[ITEM]{
-		periodic:  time.Millisecond * 100,
-		batchsize: 128,
+		periodic:   time.Millisecond * 100,
+		batchsize:  128,
+		maxPending: 2,
+		capacity:   defaultCapacity,
+		concurrent: 1,
 
 		itemDo: itemDo,
-		once:   &sync.Once{},
 
-		sizeSignal: make(chan []ITEM),
-		stopSignal: make(chan struct{}),
+		resetSignal: make(chan struct{}, 1),
+		readySignal: make(chan struct{}, 1),
+		workerDone:  make(chan struct{}, 1),
 	}
+	exec.monitor.SetKind("threshold.ThresholdExecute")
 	// exec.AsyncExecute()
 	return exec
 }
 
-func (exec *ThresholdExecute[ITEM]) getBatch() []ITEM {
-	exec.mu.Lock()
-	defer exec.mu.Unlock()
-	items := exec.items[:]
-	exec.items = exec.items[:0]
-	return items
+// NewThresholdExecuteContext 以带上下文的执行函数创建. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消,
+// 返回的错误合并为批次的错误. WithBatchSizeHandler 和 WithPeriodicHandler 设置的函数优先
+func NewThresholdExecuteContext[ITEM any](execDo func(ctx context.Context, item ITEM) error) *ThresholdExecute[ITEM] {
+	exec := NewThresholdExecute[ITEM](nil)
+	exec.execDo = execDo
+	return exec
+}
+
+// pendingBatch 取出的批次, ctxs 与 items 一一对应, 批次跨度关联其中的跨度
+type pendingBatch[ITEM any] struct {
+	items []ITEM
+	ctxs  []context.Context
 }
 
-// AsyncExecute 返回自身. 方便与With设置连用
+// thresholdRun 一次 AsyncExecute 到 Stop 之间的执行循环
+type thresholdRun struct {
+	stop chan struct{} // Stop 时关闭, 通知执行循环退出
+	done chan struct{} // 执行循环退出后关闭
+}
+
+// handlers 按触发方式选择执行函数, 调用方持有 mu
+func (exec *ThresholdExecute[ITEM]) handlers() (itemSizeDo, itemPeriodicDo func(i int, item ITEM), recoverDo func(ierr any)) {
+	itemSizeDo, itemPeriodicDo = exec.itemDo, exec.itemDo
+	if exec.itemSizeDo != nil {
+		itemSizeDo = exec.itemSizeDo
+	}
+	if exec.itemPeriodicDo != nil {
+		itemPeriodicDo = exec.itemPeriodicDo
+	}
+	return itemSizeDo, itemPeriodicDo, exec.recoverDo
+}
+
+// AsyncExecute 开始执行循环, 返回自身. 方便与With设置连用. 已停止时重新开始, 运行中或已关闭时什么也不做
 func (exec *ThresholdExecute[ITEM]) AsyncExecute() *ThresholdExecute[ITEM] {
+	exec.lifecycle.Lock()
+	defer exec.lifecycle.Unlock()
 
-	go exec.once.Do(func() {
-		var itemPeriodicDo func(i int, item ITEM)
-		var itemSizeDo func(i int, item ITEM)
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	if exec.closed || exec.run != nil || exec.monitor.State() == basic.StateClosed {
+		return exec
+	}
 
-		overTimer := time.NewTicker(exec.periodic)
+	run := &thresholdRun{stop: make(chan struct{}), done: make(chan struct{})}
+	exec.run = run
+	exec.monitor.SetState(basic.StateRunning)
+	go exec.loop(run)
+	// 开始前收集的数据可能已经达到 batchsize
+	exec.ready()
+	return exec
+}
 
-		for {
+// loop 执行循环, run.stop 关闭后退出. 剩下的数据由 Stop 处理
+func (exec *ThresholdExecute[ITEM]) loop(run *thresholdRun) {
+	defer close(run.done)
 
+	exec.mu.Lock()
+	overTimer := time.NewTicker(exec.periodic)
+	exec.mu.Unlock()
+	defer overTimer.Stop()
+
+	for {
+		select {
+		case <-overTimer.C:
+			exec.drain(context.Background(), run.stop, true)
+		case <-exec.readySignal:
+			exec.drain(context.Background(), run.stop, false)
+		case <-exec.resetSignal:
 			exec.mu.Lock()
+			overTimer.Reset(exec.periodic)
+			exec.mu.Unlock()
+		case <-run.stop:
+			return
+		}
+	}
+}
 
-			if exec.itemPeriodicDo != nil {
-				itemPeriodicDo = exec.itemPeriodicDo
-			} else {
-				itemPeriodicDo = exec.itemDo
-			}
+// ready 通知执行循环有新的批次, 不等待
+func (exec *ThresholdExecute[ITEM]) ready() {
+	select {
+	case exec.readySignal <- struct{}{}:
+	default:
+	}
+}
 
-			if exec.itemSizeDo != nil {
-				itemSizeDo = exec.itemSizeDo
-			} else {
-				itemSizeDo = exec.itemDo
+// drain 按顺序开始等待的批次, partial 为 true 时最后开始正在收集的数据. stop 关闭时开始完当前批次后返回.
+// 并发数为 1 时在当前协程执行, 否则等待有空闲的并发数后在新协程执行. 等待中 stop 关闭或 ctx 结束时
+// 批次放回等待队列, 返回 basic.ErrClosed 或 ctx.Err().
+// 执行循环, 没有运行时的 Flush 和 Stop 都可能调用, 同一时间只有一个 drain 取批次
+func (exec *ThresholdExecute[ITEM]) drain(ctx context.Context, stop <-chan struct{}, partial bool) error {
+	exec.draining.Lock()
+	defer exec.draining.Unlock()
+
+	executed := false
+	for {
+		// 停止后不再取下一个批次, 执行循环的 select 可能在 stop 关闭后仍然选到周期
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+
+		exec.mu.Lock()
+		batch, itemDo, recoverDo := exec.next(partial)
+		concurrent := exec.concurrent
+		exec.mu.Unlock()
+		if batch.items == nil {
+			break
+		}
+
+		if concurrent <= 1 {
+			exec.execute(exec.committer.Next(), batch, itemDo, recoverDo)
+		} else {
+			if err := exec.acquire(ctx, stop, concurrent); err != nil {
+				// 没有开始的批次放回等待队列的头部, 由之后的 drain 或 Shutdown 处理
+				exec.mu.Lock()
+				exec.pending = append([]pendingBatch[ITEM]{batch}, exec.pending...)
+				exec.mu.Unlock()
+				return err
 			}
-			exec.mu.Unlock()
+			seq := exec.committer.Next()
+			go func() {
+				defer exec.release()
+				exec.execute(seq, batch, itemDo, recoverDo)
+			}()
+		}
+		executed = true
+	}
+	if executed {
+		exec.idle()
+	}
+	return nil
+}
 
-			select {
-			case <-overTimer.C:
+// next 取出下一个要执行的批次和对应的执行函数, 没有时批次的 items 为 nil. 调用方持有 mu.
+// 先执行达到 batchsize 的批次, partial 为 true 或 Flush 后再执行正在收集的数据
+func (exec *ThresholdExecute[ITEM]) next(partial bool) (pendingBatch[ITEM], func(i int, item ITEM), func(ierr any)) {
+	itemSizeDo, itemPeriodicDo, recoverDo := exec.handlers()
+
+	exec.promote()
+	if len(exec.pending) != 0 {
+		batch := exec.pending[0]
+		exec.pending[0] = pendingBatch[ITEM]{}
+		exec.pending = exec.pending[1:]
+		exec.promote()
+		exec.freed()
+		return batch, itemSizeDo, recoverDo
+	}
 
-				items := exec.getBatch()
-				for i, item := range items {
-					itemPeriodicDo(i, item)
-				}
+	if (partial || exec.flushing) && len(exec.items) != 0 {
+		exec.flushing = false
+		exec.freed()
+		return exec.takeItems(), itemPeriodicDo, recoverDo
+	}
+	exec.flushing = false
+	return pendingBatch[ITEM]{}, nil, nil
+}
 
-			case items := <-exec.sizeSignal:
-				for i, item := range items {
-					itemSizeDo(i, item)
-				}
-			case <-exec.stopSignal:
-				return
-			}
+// promote 正在收集的数据达到 batchsize 时切出批次放入 pending, 返回是否有新的批次. 调用方持有 mu.
+// pending 达到 maxPending 时数据留在 items 中继续收集, 执行循环取走批次后再切出. 缓存达到 capacity 时收集方等待 freed
+func (exec *ThresholdExecute[ITEM]) promote() bool {
+	size := max(exec.batchsize, 1)
+	promoted := false
+	for len(exec.items) >= size && len(exec.pending) < max(exec.maxPending, 1) {
+		if len(exec.items) == size {
+			exec.pending = append(exec.pending, exec.takeItems())
+		} else {
+			// 批次的容量限制在 size, 之后 append 到 items 不会覆盖批次
+			exec.pending = append(exec.pending, pendingBatch[ITEM]{items: exec.items[:size:size], ctxs: exec.ctxs[:size:size]})
+			exec.items, exec.ctxs = exec.items[size:], exec.ctxs[size:]
 		}
+		promoted = true
+	}
+	return promoted
+}
+
+// freed 缓存有了空位, 唤醒等待的收集方. 调用方持有 mu
+func (exec *ThresholdExecute[ITEM]) freed() {
+	if exec.space != nil {
+		close(exec.space)
+		exec.space = nil
+	}
+}
+
+// queued 等待执行的数据量, 调用方持有 mu
+func (exec *ThresholdExecute[ITEM]) queued() int {
+	n := len(exec.items)
+	for _, batch := range exec.pending {
+		n += len(batch.items)
+	}
+	return n
+}
+
+// idle 执行完批次后没有缓存的数据, 通知进入空闲
+func (exec *ThresholdExecute[ITEM]) idle() {
+	exec.mu.Lock()
+	n := exec.queued()
+	exec.mu.Unlock()
+
+	if n == 0 {
+		exec.monitor.Idle()
+	}
+}
+
+// acquire 等待正在执行的批次数小于 concurrent 后占用一个. stop 关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err()
+func (exec *ThresholdExecute[ITEM]) acquire(ctx context.Context, stop <-chan struct{}, concurrent int) error {
+	for exec.running.Load() >= int64(concurrent) {
+		select {
+		case <-exec.workerDone:
+		case <-stop:
+			return basic.ErrClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	exec.running.Add(1)
+	exec.workers.Add(1)
+	return nil
+}
+
+// wait 等待并发执行中的批次全部执行完, ctx 结束返回 ctx.Err()
+func (exec *ThresholdExecute[ITEM]) wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		exec.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// release 批次执行完, 通知等待空闲并发数的 acquire
+func (exec *ThresholdExecute[ITEM]) release() {
+	exec.running.Add(-1)
+	exec.workers.Done()
+	select {
+	case exec.workerDone <- struct{}{}:
+	default:
+	}
+}
+
+// execute 执行序号 seq 的批次后按顺序提交. panic 会被 recover, 并交给 recoverDo 处理
+func (exec *ThresholdExecute[ITEM]) execute(seq uint64, batch pendingBatch[ITEM], itemDo func(i int, item ITEM), recoverDo func(ierr any)) {
+	items := batch.items
+	err := exec.monitor.Execute(basic.ContextLinks(&exec.monitor, batch.ctxs...), len(items), func(ctx context.Context) error {
+		return exec.middleware.Then(func(ctx context.Context, items []ITEM) error {
+			if itemDo == nil {
+				return basic.HandleItems(ctx, items, exec.execDo)
+			}
+			for i, item := range items {
+				itemDo(i, item)
+			}
+			return nil
+		})(ctx, items)
 	})
-	return exec
+
+	exec.committer.Done(&exec.monitor, seq, items, err)
+
+	var perr *basic.PanicError
+	if recoverDo != nil && errors.As(err, &perr) {
+		recoverDo(perr.Value)
+	}
+}
+
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (pe *ThresholdExecute[ITEM]) WithMetrics(metrics basic.Metrics) *ThresholdExecute[ITEM] {
+	pe.monitor.SetMetrics(metrics)
+	return pe
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (pe *ThresholdExecute[ITEM]) WithTracer(tracer basic.Tracer) *ThresholdExecute[ITEM] {
+	pe.monitor.SetTracer(tracer)
+	return pe
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (pe *ThresholdExecute[ITEM]) WithLogger(logger *slog.Logger) *ThresholdExecute[ITEM] {
+	pe.monitor.SetLogger(logger)
+	return pe
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (pe *ThresholdExecute[ITEM]) WithName(name string) *ThresholdExecute[ITEM] {
+	pe.monitor.SetName(name)
+	return pe
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (pe *ThresholdExecute[ITEM]) WithHooks(hooks basic.Hooks) *ThresholdExecute[ITEM] {
+	pe.monitor.SetHooks(hooks)
+	return pe
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (pe *ThresholdExecute[ITEM]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *ThresholdExecute[ITEM] {
+	pe.middleware.Use(middlewares...)
+	return pe
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后批次以 basic.ErrHandlerTimeout 结束并继续执行下一个批次. 小于等于0不超时
+func (pe *ThresholdExecute[ITEM]) WithHandlerTimeout(d time.Duration) *ThresholdExecute[ITEM] {
+	pe.monitor.SetHandlerTimeout(d)
+	return pe
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach
+func (pe *ThresholdExecute[ITEM]) WithAbandonPolicy(policy basic.AbandonPolicy) *ThresholdExecute[ITEM] {
+	pe.monitor.SetAbandonPolicy(policy)
+	return pe
 }
 
 func (pe *ThresholdExecute[ITEM]) WithRecover(recoverDo func(ierr any)) *ThresholdExecute[ITEM] {
@@ -111,6 +410,47 @@ func (pe *ThresholdExecute[ITEM]) WithBatchSize(bsize int) *ThresholdExecute[ITE
 	return pe
 }
 
+// WithConcurrent 设置同时执行的批次数, 默认 1 按顺序执行. 大于 1 时批次在新协程中执行, 执行完的顺序不确定,
+// 需要按顺序提交时使用 WithOnCommit. 小于1按1处理
+func (pe *ThresholdExecute[ITEM]) WithConcurrent(n int) *ThresholdExecute[ITEM] {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	pe.concurrent = max(n, 1)
+	return pe
+}
+
+// WithOnCommit 设置批次的提交函数, 批次执行完后严格按批次开始的顺序调用, seq 从 1 开始.
+// 执行失败, 超时和关闭时丢弃的批次同样提交, err 为批次的错误, 只有 err 为 nil 时才能提交消费位置.
+// AbandonDetach 下超时的批次以 basic.ErrHandlerTimeout 提交时执行函数可能还在运行
+func (pe *ThresholdExecute[ITEM]) WithOnCommit(onCommitDo func(seq uint64, items []ITEM, err error)) *ThresholdExecute[ITEM] {
+	pe.committer.SetOnCommit(onCommitDo)
+	return pe
+}
+
+// WithCapacity 设置缓存的数据上限, 包括等待执行的批次, 默认 1<<16. 达到上限时 Collect 和 Submit 等待执行循环取走数据,
+// TrySubmit 返回 basic.ErrQueueFull. 小于 batchsize 时只能按周期执行. 小于1使用默认值
+func (pe *ThresholdExecute[ITEM]) WithCapacity(n int) *ThresholdExecute[ITEM] {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if n < 1 {
+		n = defaultCapacity
+	}
+	pe.capacity = n
+	pe.freed()
+	return pe
+}
+
+// WithMaxPending 设置达到 batchsize 等待执行的批次上限, 默认 2. 达到上限后数据继续缓存, 执行循环空出位置后再分批
+func (pe *ThresholdExecute[ITEM]) WithMaxPending(n int) *ThresholdExecute[ITEM] {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	pe.maxPending = n
+	return pe
+}
+
 func (pe *ThresholdExecute[ITEM]) WithBatchSizeHandler(itemSizeDo func(i int, item ITEM)) *ThresholdExecute[ITEM] {
 	pe.mu.Lock()
 	defer pe.mu.Unlock()
@@ -119,14 +459,64 @@ func (pe *ThresholdExecute[ITEM]) WithBatchSizeHandler(itemSizeDo func(i int, it
 	return pe
 }
 
+// WithPeriodic 设置周期, 运行中修改会重新开始计时
 func (pe *ThresholdExecute[ITEM]) WithPeriodic(per time.Duration) *ThresholdExecute[ITEM] {
 	pe.mu.Lock()
-	defer pe.mu.Unlock()
-
 	pe.periodic = per
+	pe.mu.Unlock()
+
+	pe.resetPeriodic()
 	return pe
 }
 
+// resetPeriodic 通知执行循环按新的周期重新计时
+func (pe *ThresholdExecute[ITEM]) resetPeriodic() {
+	select {
+	case pe.resetSignal <- struct{}{}:
+	default:
+	}
+}
+
+// Reconfigure 修改运行中的参数: 周期, 批次数量, 并发数和限速. 修改周期会重新开始计时.
+// 参数都合法时全部生效, 否则都不生效. 返回实际的修改
+func (pe *ThresholdExecute[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	changes, err := pe.monitor.Reconfigure(t, basic.TunePeriodic|basic.TuneBatchSize|basic.TuneConcurrency)
+	if err != nil {
+		return nil, err
+	}
+
+	pe.mu.Lock()
+	if t.Periodic > 0 {
+		changes = basic.Changed(changes, "periodic", pe.periodic, t.Periodic)
+		pe.periodic = t.Periodic
+	}
+	if t.BatchSize > 0 {
+		changes = basic.Changed(changes, "batch_size", pe.batchsize, t.BatchSize)
+		pe.batchsize = t.BatchSize
+		if pe.promote() && pe.run != nil {
+			pe.ready()
+		}
+	}
+	if t.Concurrency > 0 {
+		changes = basic.Changed(changes, "concurrency", pe.concurrent, t.Concurrency)
+		pe.concurrent = t.Concurrency
+	}
+	pe.mu.Unlock()
+
+	if t.Concurrency > 0 {
+		// 等待空闲并发数的循环重新检查
+		select {
+		case pe.workerDone <- struct{}{}:
+		default:
+		}
+	}
+
+	if t.Periodic > 0 {
+		pe.resetPeriodic()
+	}
+	return pe.monitor.Reconfigured(changes), nil
+}
+
 func (pe *ThresholdExecute[ITEM]) WithPeriodicHandler(itemPeriodicDo func(i int, item ITEM)) *ThresholdExecute[ITEM] {
 	pe.mu.Lock()
 	defer pe.mu.Unlock()
@@ -135,23 +525,209 @@ func (pe *ThresholdExecute[ITEM]) WithPeriodicHandler(itemPeriodicDo func(i int,
 	return pe
 }
 
-// Collect 收集数据
-func (exec *ThresholdExecute[ITEM]) Collect(item ITEM) {
+// Collect 收集数据. 停止中或已停止返回 ErrStopped, 已 Shutdown 返回 basic.ErrClosed.
+// 达到 batchsize 时通知执行循环, 不等待批次执行. 缓存达到 capacity 时等待执行循环取走数据,
+// 没有运行时没有人取走数据, 返回 basic.ErrQueueFull
+func (exec *ThresholdExecute[ITEM]) Collect(item ITEM) error {
+	return exec.collect(context.Background(), item, true)
+}
+
+// collect 收集数据, wait 为 false 时缓存满了不等待
+func (exec *ThresholdExecute[ITEM]) collect(ctx context.Context, item ITEM, wait bool) error {
 	exec.mu.Lock()
 	defer exec.mu.Unlock()
+
+	for {
+		if exec.closed {
+			return basic.ErrClosed
+		}
+		switch exec.monitor.State() {
+		case basic.StateStopping, basic.StateStopped:
+			return ErrStopped
+		}
+		if exec.queued() < exec.capacity {
+			break
+		}
+		if !wait || exec.run == nil {
+			return basic.ErrQueueFull
+		}
+
+		if exec.space == nil {
+			exec.space = make(chan struct{})
+		}
+		space, stop := exec.space, exec.run.stop
+		exec.mu.Unlock()
+		select {
+		case <-space:
+		case <-stop:
+		case <-ctx.Done():
+			exec.mu.Lock()
+			return ctx.Err()
+		}
+		exec.mu.Lock()
+	}
+
 	exec.items = append(exec.items, item)
-	if len(exec.items) >= exec.batchsize {
-		items := exec.items[:]
-		exec.items = exec.items[:0]
-		exec.sizeSignal <- items
+	exec.ctxs = append(exec.ctxs, ctx)
+	exec.monitor.Collected(1)
+	exec.monitor.QueueDepth(exec.queued())
+	if exec.promote() && exec.run != nil {
+		exec.ready()
 	}
+	return nil
 }
 
-// Stop 停止执行
+// CollectContext 同 Collect, 批次跨度会关联 ctx 中的跨度. 缓存满时的等待不受 ctx 影响
+func (exec *ThresholdExecute[ITEM]) CollectContext(ctx context.Context, item ITEM) error {
+	return exec.collect(context.WithoutCancel(ctx), item, true)
+}
+
+// Submit 同 Collect, 缓存满时等待到 ctx 结束返回 ctx.Err(). 批次跨度会关联 ctx 中的跨度
+func (exec *ThresholdExecute[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	return exec.collect(ctx, item, true)
+}
+
+// TrySubmit 同 Collect, 缓存满时返回 basic.ErrQueueFull
+func (exec *ThresholdExecute[ITEM]) TrySubmit(item ITEM) error {
+	return exec.collect(context.Background(), item, false)
+}
+
+// takeItems 取出正在收集的全部数据, 调用方持有 mu. 返回的切片不再和缓存共用底层数组
+func (exec *ThresholdExecute[ITEM]) takeItems() pendingBatch[ITEM] {
+	batch := pendingBatch[ITEM]{items: exec.items, ctxs: exec.ctxs}
+	exec.items, exec.ctxs = nil, nil
+	return batch
+}
+
+// Flush 立即执行缓存的数据, 并等待调用前收集的数据全部执行完并提交. 没有运行时在当前协程执行.
+// 暂停中数据留在缓存, 恢复后按周期执行, Flush 返回 basic.ErrPaused
+func (exec *ThresholdExecute[ITEM]) Flush(ctx context.Context) error {
+	exec.mu.Lock()
+	switch state := exec.monitor.State(); {
+	case exec.run != nil:
+		if state != basic.StatePaused {
+			exec.flushing = true
+			exec.ready()
+		}
+		exec.mu.Unlock()
+	case state == basic.StateStopping:
+		// Stop 会执行剩下的数据
+		exec.mu.Unlock()
+	default:
+		exec.mu.Unlock()
+		if err := exec.drain(ctx, nil, true); err != nil {
+			return err
+		}
+	}
+	if err := exec.monitor.Flush(ctx, nil); err != nil {
+		return err
+	}
+	return exec.committer.Wait(ctx)
+}
+
+// Shutdown 停止接收 Submit, 执行完缓存的数据后停止. ctx 结束时立即停止并返回 ctx.Err(), 缓存的数据不再执行.
+// 暂停中不等待恢复, 缓存的数据计为丢弃并返回 basic.ErrPaused
+func (exec *ThresholdExecute[ITEM]) Shutdown(ctx context.Context) error {
+	exec.mu.Lock()
+	if exec.closed {
+		exec.mu.Unlock()
+		return nil
+	}
+	exec.closed = true
+	exec.mu.Unlock()
+
+	err := exec.Flush(ctx)
+	stopped, serr := exec.stop(ctx, false)
+	if !stopped {
+		exec.monitor.Shutdown()
+	}
+	if err == nil {
+		err = serr
+	}
+	exec.monitor.SetState(basic.StateClosed)
+
+	exec.mu.Lock()
+	dropped := exec.queued()
+	exec.items, exec.ctxs, exec.pending = nil, nil, nil
+	exec.freed()
+	exec.mu.Unlock()
+	if dropped != 0 {
+		exec.monitor.Dropped(dropped, basic.ErrClosed)
+	}
+	return err
+}
+
+// Pause 暂停执行, 继续收集数据. 暂停中数据全部留在缓存, 正在执行的批次执行完后不再执行新的批次, 直到 Resume
+func (pe *ThresholdExecute[ITEM]) Pause() {
+	pe.monitor.Pause()
+}
+
+// Resume 恢复执行, 缓存的数据在下一个周期或达到 batchsize 时执行
+func (pe *ThresholdExecute[ITEM]) Resume() {
+	pe.monitor.Resume()
+}
+
+// Stop 停止执行循环, 执行完缓存的数据后进入已停止. 之后 Collect 返回 ErrStopped, 调用 AsyncExecute 重新开始.
+// 没有运行时什么也不做
 func (pe *ThresholdExecute[ITEM]) Stop() {
-	pe.stopSignal <- struct{}{}
+	pe.stop(context.Background(), true)
+}
+
+// stop 停止执行循环, drain 为 true 时执行缓存的数据. 返回是否停止了运行中的执行循环.
+// ctx 结束时不再等待执行循环和执行中的批次, 返回 ctx.Err()
+func (pe *ThresholdExecute[ITEM]) stop(ctx context.Context, drain bool) (bool, error) {
+	pe.lifecycle.Lock()
+	defer pe.lifecycle.Unlock()
 
 	pe.mu.Lock()
-	defer pe.mu.Unlock()
-	pe.once = &sync.Once{}
+	run := pe.run
+	if run == nil {
+		pe.mu.Unlock()
+		return false, nil
+	}
+	// 先离开暂停状态, 等待恢复的批次才能执行完. 停止中不再接收数据
+	if drain {
+		pe.monitor.SetState(basic.StateStopping)
+	}
+	pe.run = nil
+	pe.mu.Unlock()
+
+	// 等待执行循环开始完当前批次退出
+	close(run.stop)
+	if !drain {
+		// 不执行剩下的数据, 等待恢复的批次计为丢弃. 先关闭 stop, 执行循环不会再取下一个批次
+		pe.monitor.SetState(basic.StateClosed)
+	}
+	var err error
+	select {
+	case <-run.done:
+		if drain {
+			err = pe.drain(ctx, nil, true)
+		}
+		if err == nil {
+			err = pe.wait(ctx)
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	pe.monitor.Shutdown()
+	pe.monitor.SetState(basic.StateStopped)
+	return true, err
+}
+
+// Stats 运行状态的快照. 数据在达到 batchsize 前缓存在切片中, QueueCap 为 WithCapacity 设置的上限
+func (pe *ThresholdExecute[ITEM]) Stats() basic.Stats {
+	stats := pe.monitor.Stats()
+
+	pe.mu.Lock()
+	stats.QueueLen = pe.queued()
+	stats.QueueCap = pe.capacity
+	pe.mu.Unlock()
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (pe *ThresholdExecute[ITEM]) Settled() <-chan struct{} {
+	return pe.monitor.Settled()
 }
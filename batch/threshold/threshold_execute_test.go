@@ -1,11 +1,14 @@
 package threshold_test
 
 import (
+	"context"
 	"log"
+	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/batch/threshold"
 )
 
@@ -31,3 +34,417 @@ func TestA1(t *testing.T) {
 	}
 
 }
+
+func TestThresholdStats(t *testing.T) {
+	var counter atomic.Int32
+
+	e := threshold.NewThresholdExecute[int](func(i int, item int) {
+		counter.Add(1)
+	}).WithBatchSize(4).WithPeriodic(time.Hour)
+	if stats := e.Stats(); stats.State != basic.StateCreated {
+		t.Errorf("期望未开始, 实际 %s", stats.State)
+	}
+
+	e.AsyncExecute()
+	time.Sleep(time.Millisecond * 10)
+	for i := 0; i < 6; i++ {
+		e.Collect(i)
+	}
+	time.Sleep(time.Millisecond * 20)
+
+	stats := e.Stats()
+	if stats.State != basic.StateRunning || stats.QueueLen != 2 || stats.Collected != 6 || stats.Processed != 4 {
+		t.Errorf("统计错误 %+v", stats)
+	}
+	if stats.LastBatchSize != 4 || counter.Load() != 4 {
+		t.Errorf("期望执行一个 4 个数据的批次, 实际 %+v %d", stats, counter.Load())
+	}
+
+	e.Stop()
+	if e.Stats().State != basic.StateStopped {
+		t.Errorf("期望已停止, 实际 %s", e.Stats().State)
+	}
+}
+
+func TestThresholdReconfigure(t *testing.T) {
+	var counter atomic.Int32
+
+	e := threshold.NewThresholdExecute[int](func(i int, item int) {
+		counter.Add(1)
+	}).WithBatchSize(100).WithPeriodic(time.Hour).AsyncExecute()
+	defer e.Stop()
+
+	time.Sleep(time.Millisecond * 10)
+	e.Collect(1)
+
+	changes, err := e.Reconfigure(basic.Tuning{Periodic: time.Millisecond * 5, BatchSize: 2})
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("修改错误 %v %v", changes, err)
+	}
+	time.Sleep(time.Millisecond * 30)
+	if counter.Load() != 1 {
+		t.Errorf("修改周期后应该重新计时, 实际执行 %d", counter.Load())
+	}
+
+	if _, err := e.Reconfigure(basic.Tuning{Capacity: 2}); err == nil {
+		t.Error("不支持的参数应该返回错误")
+	}
+}
+
+func TestThresholdRestart(t *testing.T) {
+	var counter atomic.Int32
+	release := make(chan struct{})
+
+	e := threshold.NewThresholdExecute[int](func(i int, item int) {
+		<-release
+		counter.Add(1)
+	}).WithBatchSize(2).WithPeriodic(time.Hour)
+
+	// 没有开始时 Stop 不阻塞
+	e.Stop()
+	if err := e.Collect(1); err != nil {
+		t.Fatalf("开始前应该可以收集, 实际 %v", err)
+	}
+
+	e.AsyncExecute()
+	e.Collect(2) // 第一个批次阻塞在执行函数中
+
+	// 执行循环繁忙, 达到 batchsize 的批次等待执行
+	collected := make(chan error)
+	go func() {
+		e.Collect(3)
+		collected <- e.Collect(4)
+	}()
+	time.Sleep(time.Millisecond * 10)
+
+	stopped := make(chan struct{})
+	go func() {
+		e.Stop()
+		close(stopped)
+	}()
+	if err := <-collected; err != nil {
+		t.Fatalf("Stop 前收集的数据期望成功, 实际 %v", err)
+	}
+	close(release)
+	<-stopped
+
+	if n := counter.Load(); n != 4 {
+		t.Errorf("Stop 后期望执行全部 4 个数据, 实际 %d", n)
+	}
+	if stats := e.Stats(); stats.State != basic.StateStopped || stats.QueueLen != 0 {
+		t.Errorf("期望已停止且没有缓存, 实际 %+v", stats)
+	}
+	if err := e.Collect(5); err != threshold.ErrStopped {
+		t.Errorf("已停止期望 ErrStopped, 实际 %v", err)
+	}
+
+	e.AsyncExecute()
+	e.Collect(5)
+	e.Collect(6)
+	time.Sleep(time.Millisecond * 20)
+	if n := counter.Load(); n != 6 {
+		t.Errorf("重新开始后期望执行 6 个数据, 实际 %d", n)
+	}
+
+	e.Shutdown(context.Background())
+	e.AsyncExecute()
+	if err := e.Collect(7); err != basic.ErrClosed {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+	if e.Stats().State != basic.StateClosed {
+		t.Errorf("关闭后不能重新开始, 实际 %s", e.Stats().State)
+	}
+}
+
+func TestThresholdConcurrentCollect(t *testing.T) {
+	const producers, perProducer = 8, 5000
+
+	var counter atomic.Int64
+	var batches atomic.Int32
+	release := make(chan struct{})
+
+	e := threshold.NewThresholdExecute[int](func(i int, item int) {
+		if i == 0 && batches.Add(1) == 1 {
+			<-release // 执行函数阻塞时收集方不能被阻塞
+		}
+		counter.Add(1)
+	}).WithBatchSize(64).WithPeriodic(time.Millisecond).AsyncExecute()
+
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				if err := e.Collect(i); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+
+	collected := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(collected)
+	}()
+	select {
+	case <-collected:
+	case <-time.After(time.Second * 5):
+		t.Fatal("执行函数阻塞时 Collect 被阻塞")
+	}
+	close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if n := counter.Load(); n != producers*perProducer {
+		t.Errorf("期望执行 %d, 实际 %d", producers*perProducer, n)
+	}
+	if stats := e.Stats(); stats.Processed != producers*perProducer || stats.Dropped != 0 || stats.QueueLen != 0 {
+		t.Errorf("统计错误 %+v", stats)
+	}
+}
+
+func TestThresholdConcurrent(t *testing.T) {
+	const batches, batchsize = 20, 4
+
+	var running, peak atomic.Int32
+	var commits []uint64
+	var committed []int
+
+	e := threshold.NewThresholdExecuteContext[int](func(ctx context.Context, item int) error {
+		n := running.Add(1)
+		defer running.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		// 前面的批次执行得更慢, 执行完的顺序和开始的顺序相反
+		time.Sleep(time.Duration(batches*batchsize-item) * time.Microsecond * 50)
+		return nil
+	}).WithBatchSize(batchsize).WithPeriodic(time.Hour).WithConcurrent(4).
+		WithOnCommit(func(seq uint64, items []int, err error) {
+			commits = append(commits, seq)
+			committed = append(committed, items...)
+		})
+
+	for i := 0; i < batches*batchsize; i++ {
+		e.Collect(i)
+	}
+	e.AsyncExecute()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if p := peak.Load(); p < 2 || p > 4 {
+		t.Errorf("期望并发执行且不超过 4 个批次, 实际同时执行 %d 个批次", p)
+	}
+	if len(commits) != batches {
+		t.Fatalf("期望提交 %d 个批次, 实际 %d", batches, len(commits))
+	}
+	for i, seq := range commits {
+		if seq != uint64(i+1) {
+			t.Fatalf("提交顺序错误 %v", commits)
+		}
+	}
+	for i, item := range committed {
+		if item != i {
+			t.Fatalf("提交的数据顺序错误 %v", committed)
+		}
+	}
+}
+
+func TestThresholdShutdownPaused(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		var count atomic.Int64
+		e := threshold.NewThresholdExecute(func(i int, item int) {
+			count.Add(1)
+		}).WithPeriodic(time.Millisecond).WithBatchSize(2)
+		if async {
+			e.AsyncExecute()
+		}
+		// 没有运行时不能暂停, Shutdown 在当前协程执行完
+		e.Pause()
+		for i := 0; i < 5; i++ {
+			e.Collect(i)
+		}
+		time.Sleep(time.Millisecond * 10)
+
+		done := make(chan error, 1)
+		go func() {
+			done <- e.Shutdown(context.Background())
+		}()
+		var err error
+		select {
+		case err = <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("async=%v 暂停中 Shutdown 没有返回", async)
+		}
+
+		stats := e.Stats()
+		if stats.State != basic.StateClosed || stats.Processed+stats.Dropped != stats.Collected {
+			t.Errorf("async=%v 统计错误 %+v", async, stats)
+		}
+		if async && (err != basic.ErrPaused || count.Load() != 0 || stats.Dropped != 5) {
+			t.Errorf("async=%v 暂停中关闭期望 ErrPaused 且全部丢弃, 实际 %v %d %+v", async, err, count.Load(), stats)
+		}
+		if !async && (err != nil || count.Load() != 5) {
+			t.Errorf("async=%v 期望执行完, 实际 %v %d", async, err, count.Load())
+		}
+	}
+}
+
+func TestThresholdShutdownTimeout(t *testing.T) {
+	block := make(chan struct{})
+	defer close(block)
+
+	e := threshold.NewThresholdExecute(func(i int, item int) {
+		<-block
+	}).WithPeriodic(time.Hour).WithBatchSize(1).WithConcurrent(2)
+	for i := 0; i < 3; i++ {
+		e.Collect(i)
+	}
+	e.AsyncExecute()
+	// 两个批次在执行, 执行循环等待空闲的并发数
+	time.Sleep(time.Millisecond * 10)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Shutdown(ctx)
+	}()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("期望 context.DeadlineExceeded, 实际 %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ctx 结束后 Shutdown 没有返回")
+	}
+	if state := e.Stats().State; state != basic.StateClosed {
+		t.Errorf("期望关闭, 实际 %s", state)
+	}
+}
+
+func TestThresholdCapacity(t *testing.T) {
+	block := make(chan struct{})
+	var count atomic.Int64
+	e := threshold.NewThresholdExecute(func(i int, item int) {
+		<-block
+		count.Add(1)
+	}).WithPeriodic(time.Hour).WithBatchSize(2).WithCapacity(4)
+
+	for i := 0; i < 4; i++ {
+		if err := e.TrySubmit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.TrySubmit(4); err != basic.ErrQueueFull {
+		t.Errorf("缓存满时期望 ErrQueueFull, 实际 %v", err)
+	}
+	// 没有运行时没有人取走数据, 不等待
+	if err := e.Collect(4); err != basic.ErrQueueFull {
+		t.Errorf("没有运行时期望 ErrQueueFull, 实际 %v", err)
+	}
+	if stats := e.Stats(); stats.QueueLen != 4 || stats.QueueCap != 4 {
+		t.Errorf("期望缓存 4/4, 实际 %d/%d", stats.QueueLen, stats.QueueCap)
+	}
+
+	// 第一个批次在执行中阻塞, 空出的位置被填满后收集方等待
+	e.AsyncExecute()
+	time.Sleep(time.Millisecond * 10)
+	for i := 0; i < 2; i++ {
+		if err := e.TrySubmit(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.TrySubmit(6); err != basic.ErrQueueFull {
+		t.Errorf("缓存满时期望 ErrQueueFull, 实际 %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if err := e.Submit(ctx, 6); err != context.DeadlineExceeded {
+		t.Errorf("缓存满时期望等待到 ctx 超时, 实际 %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- e.Collect(6)
+	}()
+	time.Sleep(time.Millisecond * 10)
+	close(block)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if count.Load() != 7 {
+		t.Errorf("期望执行 7 个, 实际 %d", count.Load())
+	}
+}
+
+// TestThresholdFlushOrder 没有运行时多个协程同时 Flush, 批次仍然一个一个执行并按取出的顺序提交
+func TestThresholdFlushOrder(t *testing.T) {
+	const n = 2000
+
+	var running, peak atomic.Int32
+	e := threshold.NewThresholdExecute(func(i int, item int) {
+		r := running.Add(1)
+		for {
+			p := peak.Load()
+			if r <= p || peak.CompareAndSwap(p, r) {
+				break
+			}
+		}
+		time.Sleep(time.Microsecond * 10)
+		running.Add(-1)
+	}).WithBatchSize(10)
+
+	var committed []int
+	var last uint64
+	e.WithOnCommit(func(seq uint64, items []int, err error) {
+		if seq != last+1 {
+			t.Errorf("期望提交序号 %d, 实际 %d", last+1, seq)
+		}
+		last = seq
+		committed = append(committed, items...)
+	})
+
+	for i := 0; i < n; i++ {
+		if err := e.Collect(i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			e.Flush(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if p := peak.Load(); p != 1 {
+		t.Errorf("并发数为 1 时期望同时执行 1 个批次, 实际 %d", p)
+	}
+	if len(committed) != n {
+		t.Fatalf("期望提交 %d 个, 实际 %d", n, len(committed))
+	}
+	for i, item := range committed {
+		if item != i {
+			t.Fatalf("第 %d 个提交的数据期望 %d, 实际 %d", i, i, item)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package execute
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+)
+
+// boundedPollInterval 执行器没有 Settled 通知时, OverflowBlock 检查是否有空位的间隔
+const boundedPollInterval = time.Millisecond
+
+// settler 数据执行完或被丢弃时通知的执行器, 内置的执行器都实现了
+type settler interface {
+	Settled() <-chan struct{}
+}
+
+// boundedExecutor 限制等待执行的数据量. 等待执行的数据量是已收集但还没有执行或丢弃的数据,
+// 多个协程同时投递时可能略微超过 capacity
+type boundedExecutor[ITEM any] struct {
+	Executor[ITEM]
+	capacity atomic.Uint64
+	overflow Overflow
+	dropped  atomic.Uint64 // OverflowDrop 丢弃的数据量
+}
+
+// full 等待执行的数据量是否达到上限
+func (b *boundedExecutor[ITEM]) full() bool {
+	stats := b.Executor.Stats()
+	settled := stats.Processed + stats.Dropped
+	if settled >= stats.Collected {
+		return false
+	}
+	return stats.Collected-settled >= b.capacity.Load()
+}
+
+// Submit 达到上限时按 overflow 处理
+func (b *boundedExecutor[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	if b.full() {
+		switch b.overflow {
+		case OverflowReject:
+			return basic.ErrQueueFull
+		case OverflowDrop:
+			b.dropped.Add(1)
+			return nil
+		}
+
+		if err := b.wait(ctx); err != nil {
+			return err
+		}
+	}
+	return b.Executor.Submit(ctx, item)
+}
+
+// wait 等待到有空位. 执行器实现了 settler 时等待通知, 否则按 boundedPollInterval 检查
+func (b *boundedExecutor[ITEM]) wait(ctx context.Context) error {
+	s, ok := b.Executor.(settler)
+	if !ok {
+		ticker := time.NewTicker(boundedPollInterval)
+		defer ticker.Stop()
+		for b.full() {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-ticker.C:
+			}
+		}
+		return nil
+	}
+
+	for {
+		// 先取通知再检查, 检查之后的变化不会错过
+		settled := s.Settled()
+		if !b.full() {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-settled:
+		}
+	}
+}
+
+// TrySubmit 达到上限时返回 basic.ErrQueueFull, OverflowDrop 丢弃并返回 nil
+func (b *boundedExecutor[ITEM]) TrySubmit(item ITEM) error {
+	if b.full() {
+		if b.overflow == OverflowDrop {
+			b.dropped.Add(1)
+			return nil
+		}
+		return basic.ErrQueueFull
+	}
+	return b.Executor.TrySubmit(item)
+}
+
+// Stats 丢弃的数据同时计入 Collected 和 Dropped, QueueCap 为 capacity
+func (b *boundedExecutor[ITEM]) Stats() basic.Stats {
+	stats := b.Executor.Stats()
+	dropped := b.dropped.Load()
+	stats.Collected += dropped
+	stats.Dropped += dropped
+	stats.QueueCap = int(b.capacity.Load())
+	return stats
+}
+
+// Reconfigure 修改容量, 其他参数交给执行器
+func (b *boundedExecutor[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	capacity := t.Capacity
+	if capacity < 0 {
+		return nil, &basic.TuningError{Field: "capacity", Value: capacity, Reason: "must not be negative"}
+	}
+
+	t.Capacity = 0
+	changes, err := b.Executor.Reconfigure(t)
+	if err != nil {
+		return nil, err
+	}
+	if capacity > 0 {
+		old := int(b.capacity.Swap(uint64(capacity)))
+		changes = basic.Changed(changes, "capacity", old, capacity)
+	}
+	return changes, nil
+}
@@ -0,0 +1,174 @@
+package execute
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/474420502/execute/basic"
+)
+
+// 执行器类型, Config.Kind 的取值
+const (
+	KindInterval   = "interval"   // periodic.ExecuteInterval
+	KindCompensate = "compensate" // periodic.ExecuteCompensate
+	KindConcurrent = "concurrent" // periodic.ConcurrentExecute
+	KindThreshold  = "threshold"  // threshold.ThresholdExecute
+	KindEvent      = "event"      // triggered.EventExecute
+)
+
+// Overflow 队列达到 Config.Capacity 时 Submit 的处理策略
+type Overflow string
+
+const (
+	// OverflowBlock 等待队列有空位或 ctx 结束, 默认策略
+	OverflowBlock Overflow = "block"
+	// OverflowReject 返回 basic.ErrQueueFull
+	OverflowReject Overflow = "reject"
+	// OverflowDrop 丢弃新数据并返回 nil, 计入 Stats().Dropped
+	OverflowDrop Overflow = "drop"
+)
+
+// Duration 可以从 "100ms", "1m30s" 这样的字符串解码的时间间隔. 实现了 encoding.TextUnmarshaler,
+// encoding/json 和常见的 YAML 库都可以直接解码
+type Duration time.Duration
+
+// UnmarshalText 按 time.ParseDuration 解析
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalText 输出 time.Duration.String 的格式
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Config 执行器的声明式配置, 由 Registry.Build 创建执行器. 零值字段使用执行器的默认值,
+// 不适用于 Kind 的字段设置了会返回 *ConfigError
+type Config struct {
+	Kind    string `json:"kind" yaml:"kind"`                     // 执行器类型, Kind 常量之一
+	Name    string `json:"name,omitempty" yaml:"name,omitempty"` // 执行器名称, 作为日志的 executor 属性
+	Handler string `json:"handler" yaml:"handler"`               // Registry 中注册的执行函数名称
+
+	Periodic    Duration `json:"periodic,omitempty" yaml:"periodic,omitempty"`       // 执行周期, event 不适用
+	BatchSize   int      `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`   // 批次数量阈值, 只适用于 threshold
+	Concurrency int      `json:"concurrency,omitempty" yaml:"concurrency,omitempty"` // 同时执行的批次数, 只适用于 concurrent 和 threshold
+
+	Capacity int      `json:"capacity,omitempty" yaml:"capacity,omitempty"` // 等待执行的数据上限, 0 使用执行器自身的队列
+	Overflow Overflow `json:"overflow,omitempty" yaml:"overflow,omitempty"` // 达到 Capacity 时的策略, 默认 block
+
+	TTL            Duration `json:"ttl,omitempty" yaml:"ttl,omitempty"`                         // 数据的存活时间, threshold 不适用
+	HandlerTimeout Duration `json:"handler_timeout,omitempty" yaml:"handler_timeout,omitempty"` // 批次执行超时
+
+	RateLimit float64 `json:"rate_limit,omitempty" yaml:"rate_limit,omitempty"` // 每秒执行的数据量, 0 不限速
+	RateBurst int     `json:"rate_burst,omitempty" yaml:"rate_burst,omitempty"` // 允许的突发量, 默认 rate_limit 向上取整
+}
+
+// Tuning 转换为运行中可以修改的参数. periodic, batch_size, concurrency, capacity 为0时保持不变, rate_limit 为0取消限速
+func (c *Config) Tuning() basic.Tuning {
+	return basic.Tuning{
+		Periodic:    time.Duration(c.Periodic),
+		BatchSize:   c.BatchSize,
+		Concurrency: c.Concurrency,
+		Capacity:    c.Capacity,
+		RateLimit:   &basic.RateLimit{Rate: c.RateLimit, Burst: c.RateBurst},
+	}
+}
+
+// ConfigError 配置错误, Field 是出错字段的 json 名称
+type ConfigError struct {
+	Name   string // Config.Name, 方便在多个配置中定位
+	Field  string
+	Value  any
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	if e.Name != "" {
+		return fmt.Sprintf("executor %q: field %s=%v: %s", e.Name, e.Field, e.Value, e.Reason)
+	}
+	return fmt.Sprintf("executor config: field %s=%v: %s", e.Field, e.Value, e.Reason)
+}
+
+// Validate 检查配置, 返回所有字段错误的合并, 每个都是 *ConfigError. 不检查执行函数是否注册
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(field string, value any, reason string) {
+		errs = append(errs, &ConfigError{Name: c.Name, Field: field, Value: value, Reason: reason})
+	}
+	unsupported := func(field string, value any) {
+		invalid(field, value, "not supported by kind "+c.Kind)
+	}
+
+	switch c.Kind {
+	case KindInterval, KindCompensate, KindConcurrent, KindThreshold, KindEvent:
+	case "":
+		invalid("kind", c.Kind, "required")
+	default:
+		invalid("kind", c.Kind, "unknown kind, want one of interval, compensate, concurrent, threshold, event")
+	}
+
+	if c.Handler == "" {
+		invalid("handler", c.Handler, "required")
+	}
+
+	if c.Periodic < 0 {
+		invalid("periodic", c.Periodic, "must not be negative")
+	} else if c.Periodic != 0 && c.Kind == KindEvent {
+		unsupported("periodic", c.Periodic)
+	}
+
+	if c.BatchSize < 0 {
+		invalid("batch_size", c.BatchSize, "must not be negative")
+	} else if c.BatchSize != 0 && c.Kind != KindThreshold {
+		unsupported("batch_size", c.BatchSize)
+	}
+
+	if c.Concurrency < 0 {
+		invalid("concurrency", c.Concurrency, "must not be negative")
+	} else if c.Concurrency != 0 && c.Kind != KindConcurrent && c.Kind != KindThreshold {
+		unsupported("concurrency", c.Concurrency)
+	}
+
+	if c.Capacity < 0 {
+		invalid("capacity", c.Capacity, "must not be negative")
+	}
+	switch c.Overflow {
+	case "", OverflowBlock, OverflowReject, OverflowDrop:
+		if c.Overflow != "" && c.Capacity == 0 {
+			invalid("overflow", c.Overflow, "requires capacity")
+		}
+	default:
+		invalid("overflow", c.Overflow, "unknown policy, want one of block, reject, drop")
+	}
+
+	if c.TTL < 0 {
+		invalid("ttl", c.TTL, "must not be negative")
+	} else if c.TTL != 0 && c.Kind == KindThreshold {
+		unsupported("ttl", c.TTL)
+	}
+
+	if c.HandlerTimeout < 0 {
+		invalid("handler_timeout", c.HandlerTimeout, "must not be negative")
+	}
+
+	if c.RateLimit < 0 {
+		invalid("rate_limit", c.RateLimit, "must not be negative")
+	}
+	if c.RateBurst < 0 {
+		invalid("rate_burst", c.RateBurst, "must not be negative")
+	} else if c.RateBurst != 0 && c.RateLimit == 0 {
+		invalid("rate_burst", c.RateBurst, "requires rate_limit")
+	}
+
+	return errors.Join(errs...)
+}
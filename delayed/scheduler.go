@@ -0,0 +1,294 @@
+package delayed
+
+import (
+	"container/heap"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/utils"
+)
+
+// Scheduler 延迟投递. 数据到期后调用 collectDo 交给执行器, 例如:
+//
+//	exec := periodic.NewExecuteInterval(handler)
+//	sched := delayed.NewScheduler(exec.Collect)
+//	id := sched.CollectAfter(item, time.Minute)
+//
+// 到期的数据会进入到期之后执行的那个批次. 投递函数返回 error 的执行器使用 NewSchedulerEx
+type Scheduler[ITEM any] struct {
+	sub *schedulerSub[ITEM]
+}
+
+type schedulerSub[ITEM any] struct {
+	mu      sync.Mutex
+	entries entryHeap[ITEM]
+	index   map[uint64]*entry[ITEM]
+	nextID  uint64
+
+	// 到期后的投递函数
+	collectDo func(item ITEM) error
+	// 投递失败的处理函数
+	onError atomic.Pointer[func(item ITEM, err error)]
+	failed  atomic.Uint64
+
+	wakeup   chan struct{}
+	stopChan chan struct{}
+	stopOnce utils.OnceNoWait
+}
+
+// Pending 等待投递的数据
+type Pending[ITEM any] struct {
+	ID    uint64
+	Item  ITEM
+	DueAt time.Time
+}
+
+func NewScheduler[ITEM any](collectDo func(item ITEM)) *Scheduler[ITEM] {
+	return NewSchedulerEx(func(item ITEM) error {
+		collectDo(item)
+		return nil
+	})
+}
+
+// NewSchedulerEx 同 NewScheduler, 投递函数返回 error, 例如 ThresholdExecute 的 Collect.
+// 投递失败的数据不会重试, 计入 Failed 并调用 WithOnError 设置的处理函数. 投递函数的 panic 会被 recover,
+// 以 *basic.PanicError 作为失败的错误
+func NewSchedulerEx[ITEM any](collectDo func(item ITEM) error) *Scheduler[ITEM] {
+	s := &Scheduler[ITEM]{
+		sub: &schedulerSub[ITEM]{
+			index:     make(map[uint64]*entry[ITEM]),
+			collectDo: collectDo,
+			wakeup:    make(chan struct{}, 1),
+			stopChan:  make(chan struct{}),
+		},
+	}
+
+	go s.sub.loopExecute()
+
+	runtime.SetFinalizer(s, func(ss *Scheduler[ITEM]) {
+		// 停止循环执行
+		ss.Close()
+	})
+
+	return s
+}
+
+// WithOnError 设置投递失败的处理函数, 在调度协程中调用. 已到期但因 Close 没有投递的数据以 basic.ErrClosed 调用.
+// 处理函数的 panic 会被 recover 并忽略
+func (s *Scheduler[ITEM]) WithOnError(onErrorDo func(item ITEM, err error)) *Scheduler[ITEM] {
+	s.sub.onError.Store(&onErrorDo)
+	return s
+}
+
+// Failed 投递失败的数量
+func (s *Scheduler[ITEM]) Failed() uint64 {
+	return s.sub.failed.Load()
+}
+
+// CollectAt 在 at 之后投递数据, 返回可用于 Cancel 的 ID
+func (s *Scheduler[ITEM]) CollectAt(item ITEM, at time.Time) uint64 {
+	sub := s.sub
+	sub.mu.Lock()
+	sub.nextID++
+	e := &entry[ITEM]{id: sub.nextID, item: item, dueAt: at}
+	heap.Push(&sub.entries, e)
+	sub.index[e.id] = e
+	first := sub.entries[0] == e
+	sub.mu.Unlock()
+
+	// 新数据最早到期时需要重置定时器
+	if first {
+		sub.notify()
+	}
+	return e.id
+}
+
+// CollectAfter 在 d 之后投递数据, 返回可用于 Cancel 的 ID
+func (s *Scheduler[ITEM]) CollectAfter(item ITEM, d time.Duration) uint64 {
+	return s.CollectAt(item, time.Now().Add(d))
+}
+
+// Cancel 取消等待投递的数据, 已投递或不存在返回 false
+func (s *Scheduler[ITEM]) Cancel(id uint64) bool {
+	sub := s.sub
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	e, ok := sub.index[id]
+	if !ok {
+		return false
+	}
+	heap.Remove(&sub.entries, e.index)
+	delete(sub.index, id)
+	return true
+}
+
+// Pending 返回所有等待投递的数据, 按到期时间排序
+func (s *Scheduler[ITEM]) Pending() []Pending[ITEM] {
+	sub := s.sub
+	sub.mu.Lock()
+	pendings := make([]Pending[ITEM], 0, len(sub.entries))
+	for _, e := range sub.entries {
+		pendings = append(pendings, Pending[ITEM]{ID: e.id, Item: e.item, DueAt: e.dueAt})
+	}
+	sub.mu.Unlock()
+
+	sort.Slice(pendings, func(i, j int) bool {
+		if pendings[i].DueAt.Equal(pendings[j].DueAt) {
+			return pendings[i].ID < pendings[j].ID
+		}
+		return pendings[i].DueAt.Before(pendings[j].DueAt)
+	})
+	return pendings
+}
+
+// Len 等待投递的数量
+func (s *Scheduler[ITEM]) Len() int {
+	s.sub.mu.Lock()
+	defer s.sub.mu.Unlock()
+	return len(s.sub.entries)
+}
+
+// Close 停止投递, 未到期的数据会被丢弃. 已到期还没有投递的数据计入 Failed
+func (s *Scheduler[ITEM]) Close() {
+	s.sub.stopOnce.Do(func() {
+		close(s.sub.stopChan)
+	})
+}
+
+func (sub *schedulerSub[ITEM]) notify() {
+	select {
+	case sub.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+func (sub *schedulerSub[ITEM]) loopExecute() {
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	for {
+		// 取出所有到期的数据, 投递在锁外执行, 执行器阻塞时不影响 CollectAt
+		var due []ITEM
+		wait := time.Hour
+
+		sub.mu.Lock()
+		now := time.Now()
+		for len(sub.entries) > 0 {
+			e := sub.entries[0]
+			if e.dueAt.After(now) {
+				wait = e.dueAt.Sub(now)
+				break
+			}
+			heap.Pop(&sub.entries)
+			delete(sub.index, e.id)
+			due = append(due, e.item)
+		}
+		sub.mu.Unlock()
+
+		for i, item := range due {
+			select {
+			case <-sub.stopChan:
+				// 已到期的数据不再投递, 计为失败
+				for _, item := range due[i:] {
+					sub.fail(item, basic.ErrClosed)
+				}
+				return
+			default:
+			}
+			if err := sub.collect(item); err != nil {
+				sub.fail(item, err)
+			}
+		}
+
+		if len(due) != 0 {
+			// 投递期间可能有新的数据到期
+			continue
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-sub.stopChan:
+			return
+		case <-sub.wakeup:
+		case <-timer.C:
+		}
+	}
+}
+
+// collect 投递一个数据, panic 会被 recover 并转换为 *basic.PanicError 返回
+func (sub *schedulerSub[ITEM]) collect(item ITEM) (err error) {
+	// recover保护, 例如执行器关闭后 Collect 向已关闭的通道发送
+	defer func() {
+		if ierr := recover(); ierr != nil {
+			err = &basic.PanicError{Value: ierr, Stack: debug.Stack()}
+		}
+	}()
+	return sub.collectDo(item)
+}
+
+// fail 记录投递失败并调用处理函数
+func (sub *schedulerSub[ITEM]) fail(item ITEM, err error) {
+	sub.failed.Add(1)
+	onError := sub.onError.Load()
+	if onError == nil || *onError == nil {
+		return
+	}
+
+	// recover保护
+	defer func() {
+		recover()
+	}()
+	(*onError)(item, err)
+}
+
+type entry[ITEM any] struct {
+	id    uint64
+	item  ITEM
+	dueAt time.Time
+	index int
+}
+
+// entryHeap 按到期时间排序的最小堆, 同时到期按 ID 先进先出
+type entryHeap[ITEM any] []*entry[ITEM]
+
+func (h entryHeap[ITEM]) Len() int { return len(h) }
+
+func (h entryHeap[ITEM]) Less(i, j int) bool {
+	if h[i].dueAt.Equal(h[j].dueAt) {
+		return h[i].id < h[j].id
+	}
+	return h[i].dueAt.Before(h[j].dueAt)
+}
+
+func (h entryHeap[ITEM]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *entryHeap[ITEM]) Push(x any) {
+	e := x.(*entry[ITEM])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *entryHeap[ITEM]) Pop() any {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return e
+}
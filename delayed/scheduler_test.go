@@ -0,0 +1,233 @@
+package delayed_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/batch/threshold"
+	"github.com/474420502/execute/delayed"
+)
+
+func TestCollectAfter(t *testing.T) {
+	var mu sync.Mutex
+	var received []int
+	var receivedAt []time.Time
+
+	s := delayed.NewScheduler(func(item int) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, item)
+		receivedAt = append(receivedAt, time.Now())
+	})
+	defer s.Close()
+
+	start := time.Now()
+	s.CollectAfter(3, time.Millisecond*60)
+	s.CollectAfter(1, time.Millisecond*20)
+	s.CollectAt(2, start.Add(time.Millisecond*40))
+
+	if s.Len() != 3 {
+		t.Errorf("期望等待投递 3 个, 实际 %d", s.Len())
+	}
+
+	time.Sleep(time.Millisecond * 120)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, []int{1, 2, 3}) {
+		t.Fatalf("期望按到期顺序投递 [1 2 3], 实际 %v", received)
+	}
+	for i, at := range receivedAt {
+		due := start.Add(time.Millisecond * 20 * time.Duration(i+1))
+		if at.Before(due) {
+			t.Errorf("第 %d 个数据提前投递了 %v", i, due.Sub(at))
+		}
+	}
+}
+
+func TestCancelAndPending(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+
+	s := delayed.NewScheduler(func(item string) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, item)
+	})
+	defer s.Close()
+
+	keep := s.CollectAfter("keep", time.Millisecond*30)
+	drop := s.CollectAfter("drop", time.Millisecond*20)
+
+	pendings := s.Pending()
+	if len(pendings) != 2 || pendings[0].ID != drop || pendings[1].ID != keep {
+		t.Fatalf("Pending 应该按到期时间排序, 实际 %v", pendings)
+	}
+
+	if !s.Cancel(drop) {
+		t.Error("取消未投递的数据应该成功")
+	}
+	if s.Cancel(drop) {
+		t.Error("重复取消应该失败")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if s.Cancel(keep) {
+		t.Error("已投递的数据不能取消")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, []string{"keep"}) {
+		t.Errorf("期望只投递 keep, 实际 %v", received)
+	}
+}
+
+func TestFeedExecutor(t *testing.T) {
+	var mu sync.Mutex
+	var received []int
+
+	e := periodic.NewExecuteInterval(func(item int) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, item)
+	}).WithPeriodic(time.Millisecond * 10)
+	defer e.Close()
+
+	s := delayed.NewScheduler(e.Collect)
+	defer s.Close()
+
+	s.CollectAfter(1, time.Millisecond*30)
+	e.Collect(0)
+
+	time.Sleep(time.Millisecond * 15)
+	mu.Lock()
+	if !reflect.DeepEqual(received, []int{0}) {
+		t.Errorf("延迟数据不应该提前执行, 实际 %v", received)
+	}
+	mu.Unlock()
+
+	time.Sleep(time.Millisecond * 60)
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, []int{0, 1}) {
+		t.Errorf("期望 [0 1], 实际 %v", received)
+	}
+}
+
+func TestFeedThreshold(t *testing.T) {
+	var mu sync.Mutex
+	var received []int
+
+	e := threshold.NewThresholdExecute(func(i int, item int) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, item)
+	}).WithBatchSize(1).AsyncExecute()
+
+	var failed []int
+	var failedErr error
+	s := delayed.NewSchedulerEx(e.Collect).WithOnError(func(item int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		failed = append(failed, item)
+		failedErr = err
+	})
+	defer s.Close()
+
+	s.CollectAfter(1, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 40)
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// 执行器已经关闭, 投递失败
+	s.CollectAfter(2, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 40)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(received, []int{1}) {
+		t.Errorf("期望执行 [1], 实际 %v", received)
+	}
+	if !reflect.DeepEqual(failed, []int{2}) || !errors.Is(failedErr, basic.ErrClosed) {
+		t.Errorf("期望 2 投递失败 ErrClosed, 实际 %v %v", failed, failedErr)
+	}
+	if s.Failed() != 1 {
+		t.Errorf("期望失败 1 个, 实际 %d", s.Failed())
+	}
+}
+
+func TestSchedulerPanic(t *testing.T) {
+	var mu sync.Mutex
+	var received []int
+	var failedErr error
+
+	s := delayed.NewScheduler(func(item int) {
+		if item == 1 {
+			panic("collect down")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, item)
+	}).WithOnError(func(item int, err error) {
+		mu.Lock()
+		failedErr = err
+		mu.Unlock()
+		panic("on error down")
+	})
+	defer s.Close()
+
+	s.CollectAfter(1, time.Millisecond*5)
+	s.CollectAfter(2, time.Millisecond*10)
+	time.Sleep(time.Millisecond * 40)
+
+	mu.Lock()
+	defer mu.Unlock()
+	var perr *basic.PanicError
+	if !errors.As(failedErr, &perr) || perr.Value != "collect down" {
+		t.Errorf("期望 PanicError, 实际 %v", failedErr)
+	}
+	if s.Failed() != 1 || !reflect.DeepEqual(received, []int{2}) {
+		t.Errorf("期望失败 1 个后继续投递 [2], 实际 %d %v", s.Failed(), received)
+	}
+}
+
+func TestSchedulerCloseDue(t *testing.T) {
+	entered := make(chan struct{})
+	block := make(chan struct{})
+	var mu sync.Mutex
+	var failed []int
+
+	s := delayed.NewScheduler(func(item int) {
+		close(entered)
+		<-block
+	}).WithOnError(func(item int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == basic.ErrClosed {
+			failed = append(failed, item)
+		}
+	})
+
+	at := time.Now().Add(time.Millisecond * 5)
+	s.CollectAt(1, at)
+	s.CollectAt(2, at)
+	s.CollectAt(3, at)
+	<-entered
+	s.Close()
+	close(block)
+	time.Sleep(time.Millisecond * 20)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if s.Failed() != 2 || !reflect.DeepEqual(failed, []int{2, 3}) {
+		t.Errorf("期望关闭时已到期的 [2 3] 计为失败, 实际 %d %v", s.Failed(), failed)
+	}
+}
@@ -0,0 +1,33 @@
+// Package execute 定义所有执行器共同的接口, 用于通过配置切换执行策略.
+// 具体的执行器在 batch/periodic, batch/threshold 和 triggered 包中
+package execute
+
+import (
+	"context"
+
+	"github.com/474420502/execute/basic"
+)
+
+// Executor 执行器的统一接口.
+//
+//   - Submit 投递数据, 队列满时等待. 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err()
+//   - TrySubmit 投递数据, 队列满时返回 basic.ErrQueueFull, 不等待
+//   - Flush 等待调用前投递的数据全部执行或丢弃, 阈值执行器会立即执行缓存的数据
+//   - Shutdown 停止接收数据, 等待已投递的数据执行完后关闭. ctx 结束时立即关闭并返回 ctx.Err()
+//   - Stats 运行状态的快照
+//   - Pause, Resume 暂停和恢复执行, 暂停中继续接收数据, Stats().State 为 basic.StatePaused
+//   - Reconfigure 修改运行中的周期, 批次数量, 并发数, 容量和限速, 返回实际的修改. 不支持的参数返回 *basic.TuningError
+//
+// 实现: periodic.ExecuteInterval, periodic.ExecuteCompensate, periodic.ConcurrentExecute,
+// periodic.PriorityExecute(以最低优先级投递), threshold.ThresholdExecute, threshold.FutureExecute(不关心结果),
+// triggered.EventExecute. triggered.Loader 按 key 合并请求, 不适用这个接口
+type Executor[ITEM any] interface {
+	Submit(ctx context.Context, item ITEM) error
+	TrySubmit(item ITEM) error
+	Flush(ctx context.Context) error
+	Shutdown(ctx context.Context) error
+	Stats() basic.Stats
+	Pause()
+	Resume()
+	Reconfigure(t basic.Tuning) ([]basic.Change, error)
+}
@@ -0,0 +1,160 @@
+package execute_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute"
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/batch/threshold"
+	"github.com/474420502/execute/triggered"
+)
+
+var (
+	_ execute.Executor[int] = (*periodic.ExecuteInterval[int])(nil)
+	_ execute.Executor[int] = (*periodic.ExecuteCompensate[int])(nil)
+	_ execute.Executor[int] = (*periodic.ConcurrentExecute[int])(nil)
+	_ execute.Executor[int] = (*periodic.PriorityExecute[int])(nil)
+	_ execute.Executor[int] = (*threshold.ThresholdExecute[int])(nil)
+	_ execute.Executor[int] = (*threshold.FutureExecute[int, int])(nil)
+	_ execute.Executor[int] = (*triggered.EventExecute[int])(nil)
+)
+
+// executors 所有实现 Executor 的执行器, 执行函数为 add
+func executors(add func(item int)) map[string]func() execute.Executor[int] {
+	return map[string]func() execute.Executor[int]{
+		"interval": func() execute.Executor[int] {
+			return periodic.NewExecuteInterval(add).WithPeriodic(time.Millisecond)
+		},
+		"compensate": func() execute.Executor[int] {
+			return periodic.NewExecuteCompensate(add).WithPeriodic(time.Millisecond)
+		},
+		"concurrent": func() execute.Executor[int] {
+			return periodic.NewConcurrentExecute(add).WithPeriodic(time.Millisecond)
+		},
+		"priority": func() execute.Executor[int] {
+			return periodic.NewPriorityExecute(add, 2).WithPeriodic(time.Millisecond)
+		},
+		"threshold": func() execute.Executor[int] {
+			return threshold.NewThresholdExecute(func(i int, item int) { add(item) }).
+				WithPeriodic(time.Hour).WithBatchSize(1000).AsyncExecute()
+		},
+		"future": func() execute.Executor[int] {
+			return threshold.NewFutureExecute(func(items []int) ([]int, error) {
+				for _, item := range items {
+					add(item)
+				}
+				return items, nil
+			}).WithPeriodic(time.Hour).WithBatchSize(1000)
+		},
+		"event": func() execute.Executor[int] {
+			return triggered.RegisterExecute(func(items *triggered.Items[int]) {
+				for _, item := range items.Value {
+					add(item)
+				}
+			})
+		},
+	}
+}
+
+func TestExecutors(t *testing.T) {
+	var count atomic.Int64
+	add := func(item int) { count.Add(int64(item)) }
+
+	for name, create := range executors(add) {
+		t.Run(name, func(t *testing.T) {
+			count.Store(0)
+			e := create()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+
+			for i := 0; i < 10; i++ {
+				if err := e.Submit(ctx, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.TrySubmit(1); err != nil {
+				t.Fatal(err)
+			}
+			if err := e.Flush(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if n := count.Load(); n != 11 {
+				t.Errorf("Flush 后期望执行 11, 实际 %d", n)
+			}
+
+			e.Submit(ctx, 1)
+			if err := e.Shutdown(ctx); err != nil {
+				t.Fatal(err)
+			}
+			if n := count.Load(); n != 12 {
+				t.Errorf("Shutdown 后期望执行 12, 实际 %d", n)
+			}
+
+			if err := e.Submit(ctx, 1); !errors.Is(err, basic.ErrClosed) {
+				t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+			}
+			if err := e.TrySubmit(1); !errors.Is(err, basic.ErrClosed) {
+				t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+			}
+
+			stats := e.Stats()
+			if stats.State != basic.StateClosed || stats.Collected != 12 || stats.Processed != 12 {
+				t.Errorf("状态错误 %+v", stats)
+			}
+		})
+	}
+}
+
+func TestPauseResume(t *testing.T) {
+	var count atomic.Int64
+	add := func(item int) { count.Add(int64(item)) }
+
+	for name, create := range executors(add) {
+		t.Run(name, func(t *testing.T) {
+			count.Store(0)
+			e := create()
+			e.Pause()
+			if state := e.Stats().State; state != basic.StatePaused {
+				t.Fatalf("期望暂停, 实际 %s", state)
+			}
+
+			ctx := context.Background()
+			for i := 0; i < 5; i++ {
+				if err := e.Submit(ctx, 1); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := e.Flush(ctx); !errors.Is(err, basic.ErrPaused) || count.Load() != 0 {
+				t.Fatalf("暂停中不应该执行, 实际 %v %d", err, count.Load())
+			}
+
+			e.Resume()
+			timeout, cancel := context.WithTimeout(ctx, time.Second)
+			defer cancel()
+			if err := e.Flush(timeout); err != nil || count.Load() != 5 {
+				t.Errorf("恢复后期望执行 5, 实际 %v %d", err, count.Load())
+			}
+
+			e.Pause()
+			e.Submit(ctx, 1)
+			e.Submit(ctx, 1)
+			// 暂停中关闭不等待恢复
+			if err := e.Shutdown(ctx); !errors.Is(err, basic.ErrPaused) {
+				t.Errorf("暂停中关闭期望 ErrPaused, 实际 %v", err)
+			}
+			// 等待的批次和队列中的数据在执行循环中计为丢弃
+			time.Sleep(time.Millisecond * 10)
+
+			stats := e.Stats()
+			if count.Load() != 5 || stats.State != basic.StateClosed || stats.Processed+stats.Dropped != stats.Collected {
+				t.Errorf("暂停中关闭不应该执行, 实际 %d %+v", count.Load(), stats)
+			}
+		})
+	}
+}
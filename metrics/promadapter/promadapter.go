@@ -0,0 +1,185 @@
+// Package promadapter 把 metrics.Collector 接入 prometheus client.
+//
+//	prom, err := metrics.NewPrometheus(promadapter.Wrap(prometheus.DefaultRegisterer), "execute")
+//	exec := periodic.NewExecuteInterval(handler).WithMetrics(prom.Executor("orders"))
+//
+// 单独作为一个模块, 只有使用 prometheus client 时才引入依赖
+package promadapter
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/474420502/execute/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector 把 metrics.Collector 适配成 prometheus.Collector
+type Collector struct {
+	c metrics.Collector
+}
+
+// NewCollector 包装 c
+func NewCollector(c metrics.Collector) *Collector {
+	return &Collector{c: c}
+}
+
+// Describe 实现 prometheus.Collector, 每个 Family 输出一个描述. Family 没有设置 LabelNames 时使用第一个样本的标签
+func (a *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, f := range a.c.Collect() {
+		names := f.LabelNames
+		if names == nil && len(f.Samples) != 0 {
+			names, _ = split(withoutLe(f.Samples[0].Labels))
+		}
+		ch <- prometheus.NewDesc(f.Name, f.Help, names, nil)
+	}
+}
+
+// Collect 实现 prometheus.Collector, 把 Family 转换成 prometheus.Metric
+func (a *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, f := range a.c.Collect() {
+		switch f.Type {
+		case metrics.Histogram:
+			collectHistogram(ch, f)
+		default:
+			valueType := prometheus.UntypedValue
+			switch f.Type {
+			case metrics.Counter:
+				valueType = prometheus.CounterValue
+			case metrics.Gauge:
+				valueType = prometheus.GaugeValue
+			}
+			for _, s := range f.Samples {
+				names, values := split(s.Labels)
+				desc := prometheus.NewDesc(s.Name, f.Help, names, nil)
+				ch <- constMetric(desc, valueType, s.Value, values)
+			}
+		}
+	}
+}
+
+// histogram 同一组标签的直方图样本
+type histogram struct {
+	names   []string
+	values  []string
+	buckets map[float64]uint64
+	sum     float64
+	count   uint64
+}
+
+// collectHistogram 按 le 以外的标签把 _bucket, _sum, _count 样本合并成直方图
+func collectHistogram(ch chan<- prometheus.Metric, f metrics.Family) {
+	var order []string
+	groups := make(map[string]*histogram)
+	group := func(labels []metrics.Label) *histogram {
+		names, values := split(labels)
+		key := strings.Join(values, "\xff")
+		h, ok := groups[key]
+		if !ok {
+			h = &histogram{names: names, values: values, buckets: make(map[float64]uint64)}
+			groups[key] = h
+			order = append(order, key)
+		}
+		return h
+	}
+
+	for _, s := range f.Samples {
+		switch s.Name {
+		case f.Name + "_bucket":
+			var le string
+			for _, l := range s.Labels {
+				if l.Name == "le" {
+					le = l.Value
+				}
+			}
+			h := group(withoutLe(s.Labels))
+			// +Inf 桶等于 _count, prometheus 自动补上
+			if upper, err := strconv.ParseFloat(le, 64); err == nil && le != "+Inf" {
+				h.buckets[upper] = uint64(s.Value)
+			}
+		case f.Name + "_sum":
+			group(s.Labels).sum = s.Value
+		case f.Name + "_count":
+			group(s.Labels).count = uint64(s.Value)
+		}
+	}
+
+	for _, key := range order {
+		h := groups[key]
+		desc := prometheus.NewDesc(f.Name, f.Help, h.names, nil)
+		m, err := prometheus.NewConstHistogram(desc, h.count, h.sum, h.buckets, h.values...)
+		if err != nil {
+			m = prometheus.NewInvalidMetric(desc, err)
+		}
+		ch <- m
+	}
+}
+
+func constMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, values []string) prometheus.Metric {
+	m, err := prometheus.NewConstMetric(desc, valueType, value, values...)
+	if err != nil {
+		return prometheus.NewInvalidMetric(desc, err)
+	}
+	return m
+}
+
+// withoutLe 去掉直方图桶的 le 标签
+func withoutLe(labels []metrics.Label) []metrics.Label {
+	out := make([]metrics.Label, 0, len(labels))
+	for _, l := range labels {
+		if l.Name != "le" {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// split 拆分标签的名称和值
+func split(labels []metrics.Label) (names, values []string) {
+	names = make([]string, len(labels))
+	values = make([]string, len(labels))
+	for i, l := range labels {
+		names[i], values[i] = l.Name, l.Value
+	}
+	return names, values
+}
+
+// Registerer 把 prometheus.Registerer 适配成 metrics.Registerer
+type Registerer struct {
+	reg prometheus.Registerer
+
+	mu         sync.Mutex
+	collectors map[metrics.Collector]*Collector
+}
+
+// Wrap 包装 reg, 注册的 metrics.Collector 转换成 Collector 注册到 reg
+func Wrap(reg prometheus.Registerer) *Registerer {
+	return &Registerer{reg: reg, collectors: make(map[metrics.Collector]*Collector)}
+}
+
+// Register 实现 metrics.Registerer
+func (r *Registerer) Register(c metrics.Collector) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	adapted := NewCollector(c)
+	if err := r.reg.Register(adapted); err != nil {
+		return err
+	}
+	r.collectors[c] = adapted
+	return nil
+}
+
+// Unregister 实现 metrics.Registerer
+func (r *Registerer) Unregister(c metrics.Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	adapted, ok := r.collectors[c]
+	if !ok {
+		return false
+	}
+	delete(r.collectors, c)
+	return r.reg.Unregister(adapted)
+}
@@ -0,0 +1,79 @@
+package promadapter_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/metrics"
+	"github.com/474420502/execute/metrics/promadapter"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterer(t *testing.T) {
+	reg := prometheus.NewPedanticRegistry()
+	wrapped := promadapter.Wrap(reg)
+	prom, err := metrics.NewPrometheus(wrapped, "execute")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 注册后才创建执行器的指标
+	m := prom.Executor("orders")
+	m.Collected(3)
+	m.BatchExecuted(2, time.Millisecond*20, nil)
+	m.BatchExecuted(1, time.Millisecond*20, errors.New("fail"))
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int)
+	for _, f := range families {
+		got[f.GetName()] = len(f.GetMetric())
+		switch f.GetName() {
+		case "execute_items_collected_total":
+			metric := f.GetMetric()[0]
+			if v := metric.GetCounter().GetValue(); v != 3 {
+				t.Errorf("期望收集 3, 实际 %v", v)
+			}
+			if l := metric.GetLabel(); len(l) != 1 || l[0].GetName() != "executor" || l[0].GetValue() != "orders" {
+				t.Errorf("标签错误 %v", l)
+			}
+		case "execute_handler_duration_seconds":
+			h := f.GetMetric()[0].GetHistogram()
+			if h.GetSampleCount() != 2 || len(h.GetBucket()) != len(metrics.DefBuckets) {
+				t.Errorf("直方图错误 %v", h)
+			}
+			for _, b := range h.GetBucket() {
+				if b.GetUpperBound() >= 0.025 && b.GetCumulativeCount() != 2 {
+					t.Errorf("桶 %v 期望 2, 实际 %d", b.GetUpperBound(), b.GetCumulativeCount())
+				}
+			}
+		}
+	}
+	if got["execute_batches_total"] != 2 || got["execute_handler_duration_seconds"] != 1 {
+		t.Errorf("指标错误 %v", got)
+	}
+
+	if !wrapped.Unregister(prom) || wrapped.Unregister(prom) {
+		t.Error("期望取消注册一次")
+	}
+	if families, _ := reg.Gather(); len(families) != 0 {
+		t.Errorf("取消注册后期望没有指标, 实际 %d", len(families))
+	}
+}
+
+func TestRegistererDuplicate(t *testing.T) {
+	wrapped := promadapter.Wrap(prometheus.NewRegistry())
+	if _, err := metrics.NewPrometheus(wrapped, "app"); err != nil {
+		t.Fatal(err)
+	}
+	var are prometheus.AlreadyRegisteredError
+	if _, err := metrics.NewPrometheus(wrapped, "app"); !errors.As(err, &are) {
+		t.Errorf("重复的指标名称期望 prometheus.AlreadyRegisteredError, 实际 %v", err)
+	}
+	if _, err := metrics.NewPrometheus(wrapped, "other"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,180 @@
+package metrics
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+)
+
+// DefBuckets 执行耗时直方图的默认桶(秒), 和 prometheus.DefBuckets 一致
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Prometheus 把执行器指标适配成 prometheus 指标, 每个执行器以 executor 标签区分.
+//
+//	reg := metrics.NewRegistry()
+//	prom, _ := metrics.NewPrometheus(reg, "execute")
+//	exec := periodic.NewExecuteInterval(handler).WithMetrics(prom.Executor("orders"))
+type Prometheus struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	executors map[string]*executorMetrics
+}
+
+// NewPrometheus 创建并注册到 reg. namespace 为空时使用 "execute"
+func NewPrometheus(reg Registerer, namespace string) (*Prometheus, error) {
+	if namespace == "" {
+		namespace = "execute"
+	}
+	p := &Prometheus{
+		namespace: namespace,
+		buckets:   DefBuckets,
+		executors: make(map[string]*executorMetrics),
+	}
+	if err := reg.Register(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Executor 返回名称为 name 的执行器指标, 同名返回同一个
+func (p *Prometheus) Executor(name string) basic.Metrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	m, ok := p.executors[name]
+	if !ok {
+		m = &executorMetrics{
+			name:    name,
+			buckets: p.buckets,
+			counts:  make([]atomic.Uint64, len(p.buckets)),
+		}
+		p.executors[name] = m
+	}
+	return m
+}
+
+// Collect 实现 Collector
+func (p *Prometheus) Collect() []Family {
+	p.mu.Lock()
+	executors := make([]*executorMetrics, 0, len(p.executors))
+	for _, m := range p.executors {
+		executors = append(executors, m)
+	}
+	p.mu.Unlock()
+
+	sort.Slice(executors, func(i, j int) bool {
+		return executors[i].name < executors[j].name
+	})
+
+	name := func(s string) string {
+		return p.namespace + "_" + s
+	}
+
+	executor := []string{"executor"}
+	collected := Family{Name: name("items_collected_total"), Help: "Total number of items collected.", Type: Counter, LabelNames: executor}
+	processed := Family{Name: name("items_processed_total"), Help: "Total number of items handed to the handler.", Type: Counter, LabelNames: executor}
+	expired := Family{Name: name("items_expired_total"), Help: "Total number of items discarded because they expired.", Type: Counter, LabelNames: executor}
+	batches := Family{Name: name("batches_total"), Help: "Total number of batches executed.", Type: Counter, LabelNames: []string{"executor", "result"}}
+	panics := Family{Name: name("panics_recovered_total"), Help: "Total number of handler panics recovered.", Type: Counter, LabelNames: executor}
+	depth := Family{Name: name("queue_depth"), Help: "Number of items waiting in the queue.", Type: Gauge, LabelNames: executor}
+	sleep := Family{Name: name("compensate_sleep_seconds_total"), Help: "Total time spent in compensation sleep.", Type: Counter, LabelNames: executor}
+	duration := Family{Name: name("handler_duration_seconds"), Help: "Handler latency per batch.", Type: Histogram, LabelNames: executor}
+
+	for _, m := range executors {
+		labels := []Label{{Name: "executor", Value: m.name}}
+		sample := func(f *Family, v float64, extra ...Label) {
+			f.Samples = append(f.Samples, Sample{Name: f.Name, Labels: append(append([]Label(nil), labels...), extra...), Value: v})
+		}
+
+		sample(&collected, float64(m.collected.Load()))
+		sample(&processed, float64(m.processed.Load()))
+		sample(&expired, float64(m.expired.Load()))
+		sample(&batches, float64(m.succeeded.Load()), Label{Name: "result", Value: "success"})
+		sample(&batches, float64(m.failed.Load()), Label{Name: "result", Value: "failure"})
+		sample(&panics, float64(m.panics.Load()))
+		sample(&depth, float64(m.depth.Load()))
+		sample(&sleep, time.Duration(m.sleep.Load()).Seconds())
+
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += m.counts[i].Load()
+			duration.Samples = append(duration.Samples, Sample{
+				Name:   duration.Name + "_bucket",
+				Labels: append(append([]Label(nil), labels...), Label{Name: "le", Value: strconv.FormatFloat(upper, 'g', -1, 64)}),
+				Value:  float64(cumulative),
+			})
+		}
+		count := m.count.Load()
+		duration.Samples = append(duration.Samples,
+			Sample{Name: duration.Name + "_bucket", Labels: append(append([]Label(nil), labels...), Label{Name: "le", Value: "+Inf"}), Value: float64(count)},
+			Sample{Name: duration.Name + "_sum", Labels: labels, Value: time.Duration(m.sum.Load()).Seconds()},
+			Sample{Name: duration.Name + "_count", Labels: labels, Value: float64(count)},
+		)
+	}
+
+	return []Family{collected, processed, expired, batches, panics, depth, sleep, duration}
+}
+
+// executorMetrics 单个执行器的指标
+type executorMetrics struct {
+	name string
+
+	collected atomic.Uint64
+	processed atomic.Uint64
+	expired   atomic.Uint64
+	succeeded atomic.Uint64
+	failed    atomic.Uint64
+	panics    atomic.Uint64
+	depth     atomic.Int64
+	sleep     atomic.Int64 // 纳秒
+
+	buckets []float64
+	counts  []atomic.Uint64 // 每个桶自己的计数, 输出时累加
+	count   atomic.Uint64
+	sum     atomic.Int64 // 纳秒
+}
+
+func (m *executorMetrics) Collected(n int) {
+	m.collected.Add(uint64(n))
+}
+
+func (m *executorMetrics) QueueDepth(depth int) {
+	m.depth.Store(int64(depth))
+}
+
+func (m *executorMetrics) BatchExecuted(size int, elapsed time.Duration, err error) {
+	m.processed.Add(uint64(size))
+	if err != nil {
+		m.failed.Add(1)
+	} else {
+		m.succeeded.Add(1)
+	}
+
+	seconds := elapsed.Seconds()
+	i := sort.SearchFloat64s(m.buckets, seconds)
+	if i < len(m.buckets) {
+		m.counts[i].Add(1)
+	}
+	m.count.Add(1)
+	m.sum.Add(int64(elapsed))
+}
+
+func (m *executorMetrics) Panic() {
+	m.panics.Add(1)
+}
+
+func (m *executorMetrics) Expired(n int) {
+	m.expired.Add(uint64(n))
+}
+
+func (m *executorMetrics) CompensateSleep(d time.Duration) {
+	m.sleep.Add(int64(d))
+}
+
+var _ basic.Metrics = (*executorMetrics)(nil)
@@ -0,0 +1,106 @@
+package metrics_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/metrics"
+)
+
+func TestPrometheusExposition(t *testing.T) {
+	reg := metrics.NewRegistry()
+	prom, err := metrics.NewPrometheus(reg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := periodic.NewExecuteCompensate(func(item int) {
+		if item == 3 {
+			panic("bad item")
+		}
+	}).WithPeriodic(time.Millisecond * 20).WithMetrics(prom.Executor("orders"))
+	defer e.Close()
+
+	e.Collect(1)
+	e.Collect(2)
+	time.Sleep(time.Millisecond * 50)
+	e.Collect(3)
+	time.Sleep(time.Millisecond * 50)
+
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+
+	for _, line := range []string{
+		"# TYPE execute_items_collected_total counter",
+		`execute_items_collected_total{executor="orders"} 3`,
+		`execute_items_processed_total{executor="orders"} 3`,
+		`execute_batches_total{executor="orders",result="success"} 1`,
+		`execute_batches_total{executor="orders",result="failure"} 1`,
+		`execute_panics_recovered_total{executor="orders"} 1`,
+		`execute_queue_depth{executor="orders"} 0`,
+		"# TYPE execute_handler_duration_seconds histogram",
+		`execute_handler_duration_seconds_bucket{executor="orders",le="+Inf"} 2`,
+		`execute_handler_duration_seconds_count{executor="orders"} 2`,
+	} {
+		if !strings.Contains(text, line+"\n") {
+			t.Errorf("缺少指标 %q\n%s", line, text)
+		}
+	}
+
+	if !strings.Contains(text, `execute_compensate_sleep_seconds_total{executor="orders"} 0.0`) {
+		t.Errorf("缺少时间补偿等待时长\n%s", text)
+	}
+}
+
+func TestRegistryDuplicate(t *testing.T) {
+	reg := metrics.NewRegistry()
+	if _, err := metrics.NewPrometheus(reg, "app"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := metrics.NewPrometheus(reg, "app"); err == nil {
+		t.Error("重复的指标名称应该注册失败")
+	}
+	if _, err := metrics.NewPrometheus(reg, "other"); err != nil {
+		t.Error(err)
+	}
+}
+
+// countingCollector 记录 Collect 的调用次数
+type countingCollector struct {
+	name  string
+	calls int
+}
+
+func (c *countingCollector) Collect() []metrics.Family {
+	c.calls++
+	return []metrics.Family{{Name: c.name, Type: metrics.Gauge}}
+}
+
+func TestRegistryStoredNames(t *testing.T) {
+	reg := metrics.NewRegistry()
+	first := &countingCollector{name: "first"}
+	reg.MustRegister(first)
+	for i := 0; i < 3; i++ {
+		reg.MustRegister(&countingCollector{name: fmt.Sprintf("other_%d", i)})
+	}
+	if first.calls != 1 {
+		t.Errorf("注册其他收集器时不应该调用已注册的 Collect, 实际调用 %d 次", first.calls)
+	}
+
+	if err := reg.Register(&countingCollector{name: "first"}); err == nil {
+		t.Error("重复的指标名称应该注册失败")
+	}
+	if !reg.Unregister(first) {
+		t.Fatal("期望取消注册")
+	}
+	if err := reg.Register(&countingCollector{name: "first"}); err != nil {
+		t.Errorf("取消注册后期望可以重新注册, 实际 %v", err)
+	}
+}
@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// MetricType 指标类型, 和 prometheus 文本格式的 TYPE 一致
+type MetricType string
+
+const (
+	Counter   MetricType = "counter"
+	Gauge     MetricType = "gauge"
+	Histogram MetricType = "histogram"
+)
+
+// Label 指标标签
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample 一个样本, Name 为完整名称(直方图包含 _bucket/_sum/_count 后缀)
+type Sample struct {
+	Name   string
+	Labels []Label
+	Value  float64
+}
+
+// Family 同名指标的集合
+type Family struct {
+	Name       string
+	Help       string
+	Type       MetricType
+	LabelNames []string // 样本的标签名称, 不包括直方图的 le. 没有样本时也用于描述指标
+	Samples    []Sample
+}
+
+// Collector 本包的指标收集器, 每次调用输出全部指标. 和 prometheus.Collector 不兼容,
+// 接入 prometheus client 使用 promadapter 子模块
+type Collector interface {
+	Collect() []Family
+}
+
+// Registerer 注册收集器. prometheus.Registerer 通过 promadapter.Wrap 转换后可以直接使用
+type Registerer interface {
+	Register(c Collector) error
+	Unregister(c Collector) bool
+}
+
+// Registry 本地的收集器注册表, 可以输出 prometheus 文本格式
+type Registry struct {
+	mu         sync.Mutex
+	collectors []Collector
+	names      map[string]Collector // 已注册的指标名称和所属的收集器
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]Collector)}
+}
+
+// Register 注册收集器, 指标名称和已注册的重复时返回错误. 指标名称在注册时从 c 收集一次, 之后不再变化
+func (r *Registry) Register(c Collector) error {
+	families := c.Collect()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.collectors {
+		if existing == c {
+			return fmt.Errorf("collector already registered")
+		}
+	}
+	for _, f := range families {
+		if _, ok := r.names[f.Name]; ok {
+			return fmt.Errorf("duplicate metric family %q", f.Name)
+		}
+	}
+
+	if r.names == nil {
+		r.names = make(map[string]Collector)
+	}
+	for _, f := range families {
+		r.names[f.Name] = c
+	}
+	r.collectors = append(r.collectors, c)
+	return nil
+}
+
+// MustRegister 注册失败时 panic
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// Unregister 取消注册, 不存在返回 false
+func (r *Registry) Unregister(c Collector) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, existing := range r.collectors {
+		if existing == c {
+			r.collectors = append(r.collectors[:i], r.collectors[i+1:]...)
+			for name, owner := range r.names {
+				if owner == c {
+					delete(r.names, name)
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Gather 收集所有指标, 按名称排序
+func (r *Registry) Gather() []Family {
+	r.mu.Lock()
+	collectors := append([]Collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	var families []Family
+	for _, c := range collectors {
+		families = append(families, c.Collect()...)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].Name < families[j].Name
+	})
+	return families
+}
+
+// WriteText 以 prometheus 文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range r.Gather() {
+		if f.Help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", f.Name, escapeHelp(f.Help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", f.Name, f.Type)
+		for _, s := range f.Samples {
+			bw.WriteString(s.Name)
+			if len(s.Labels) != 0 {
+				bw.WriteByte('{')
+				for i, l := range s.Labels {
+					if i != 0 {
+						bw.WriteByte(',')
+					}
+					fmt.Fprintf(bw, "%s=\"%s\"", l.Name, escapeLabel(l.Value))
+				}
+				bw.WriteByte('}')
+			}
+			bw.WriteByte(' ')
+			bw.WriteString(formatValue(s.Value))
+			bw.WriteByte('\n')
+		}
+	}
+	return bw.Flush()
+}
+
+// ServeHTTP 作为 /metrics 的 handler
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteText(w)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpReplacer  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpReplacer.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
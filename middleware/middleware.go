@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"context"
+	"log/slog"
+	"runtime/debug"
+	"time"
+
+	"github.com/474420502/execute/basic"
+)
+
+// Timeout 批次超时, 和执行器的 WithHandlerTimeout 使用同一套 basic.Monitor 的超时处理. next 在新协程中以 d 后取消的 ctx 执行,
+// 超时返回 basic.ErrHandlerTimeout (errors.Is 为 context.DeadlineExceeded) 且不等待 next 结束, next 应该在 ctx 取消后尽快返回.
+// 执行器会复用 items, 所以交给 next 的是副本. d 小于等于0不超时
+func Timeout[ITEM any](d time.Duration) basic.Middleware[ITEM] {
+	m := &basic.Monitor{}
+	m.SetKind("middleware.Timeout")
+	m.SetHandlerTimeout(d)
+
+	return func(next basic.BatchHandler[ITEM]) basic.BatchHandler[ITEM] {
+		return func(ctx context.Context, items []ITEM) error {
+			items = append([]ITEM(nil), items...)
+			return m.RunTimeout(ctx, len(items), func(ctx context.Context) error {
+				return next(ctx, items)
+			})
+		}
+	}
+}
+
+// Recover 把 next 的 panic 转换为 *basic.PanicError 返回, recoverDo 不为 nil 时先交给它处理.
+// 执行器本身也会 recover, 这个中间件用于让外层的中间件(例如重试)看到错误
+func Recover[ITEM any](recoverDo func(ierr any)) basic.Middleware[ITEM] {
+	return func(next basic.BatchHandler[ITEM]) basic.BatchHandler[ITEM] {
+		return func(ctx context.Context, items []ITEM) (err error) {
+			defer func() {
+				if ierr := recover(); ierr != nil {
+					if recoverDo != nil {
+						recoverDo(ierr)
+					}
+					err = &basic.PanicError{Value: ierr, Stack: debug.Stack()}
+				}
+			}()
+			return next(ctx, items)
+		}
+	}
+}
+
+// Metrics 记录 next 的耗时和结果. 执行器的 WithMetrics 记录的是整个批次,
+// 这个中间件用于单独统计被包装的部分, 应该使用和执行器不同的 metrics
+func Metrics[ITEM any](metrics basic.Metrics) basic.Middleware[ITEM] {
+	return func(next basic.BatchHandler[ITEM]) basic.BatchHandler[ITEM] {
+		return func(ctx context.Context, items []ITEM) error {
+			start := time.Now()
+			defer func() {
+				if ierr := recover(); ierr != nil {
+					metrics.Panic()
+					metrics.BatchExecuted(len(items), time.Since(start), &basic.PanicError{Value: ierr, Stack: debug.Stack()})
+					panic(ierr)
+				}
+			}()
+
+			err := next(ctx, items)
+			metrics.BatchExecuted(len(items), time.Since(start), err)
+			return err
+		}
+	}
+}
+
+// Logging 记录每个批次的数据量, 耗时和错误. 成功为 Debug 级别, 失败为 Warn 级别. logger 为 nil 使用 slog.Default()
+func Logging[ITEM any](logger *slog.Logger) basic.Middleware[ITEM] {
+	return func(next basic.BatchHandler[ITEM]) basic.BatchHandler[ITEM] {
+		return func(ctx context.Context, items []ITEM) error {
+			l := logger
+			if l == nil {
+				l = slog.Default()
+			}
+
+			start := time.Now()
+			err := next(ctx, items)
+
+			if err != nil {
+				l.LogAttrs(ctx, slog.LevelWarn, "batch handled",
+					slog.Int(basic.LogKeyItems, len(items)), slog.Duration(basic.LogKeyDuration, time.Since(start)), slog.Any(basic.LogKeyError, err))
+			} else {
+				l.LogAttrs(ctx, slog.LevelDebug, "batch handled",
+					slog.Int(basic.LogKeyItems, len(items)), slog.Duration(basic.LogKeyDuration, time.Since(start)))
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package middleware_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/middleware"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	trace := func(name string) basic.Middleware[int] {
+		return func(next basic.BatchHandler[int]) basic.BatchHandler[int] {
+			return func(ctx context.Context, items []int) error {
+				order = append(order, name+" in")
+				err := next(ctx, items)
+				order = append(order, name+" out")
+				return err
+			}
+		}
+	}
+
+	handler := basic.Chain(func(ctx context.Context, items []int) error {
+		order = append(order, "handler")
+		return nil
+	}, trace("a"), trace("b"))
+	handler(context.Background(), []int{1})
+
+	if !reflect.DeepEqual(order, []string{"a in", "b in", "handler", "b out", "a out"}) {
+		t.Errorf("中间件顺序错误 %v", order)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	handler := basic.Chain(func(ctx context.Context, items []int) error {
+		select {
+		case <-release:
+		case <-ctx.Done():
+			<-release
+		}
+		return nil
+	}, middleware.Timeout[int](time.Millisecond*20))
+
+	start := time.Now()
+	err := handler(context.Background(), []int{1})
+	if !errors.Is(err, basic.ErrHandlerTimeout) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望超时, 实际 %v", err)
+	}
+	if time.Since(start) > time.Millisecond*200 {
+		t.Errorf("超时后不应该等待处理函数结束")
+	}
+
+	handler = basic.Chain(func(ctx context.Context, items []int) error {
+		panic("boom")
+	}, middleware.Timeout[int](time.Second))
+	var perr *basic.PanicError
+	if err := handler(context.Background(), []int{1}); !errors.As(err, &perr) || len(perr.Stack) == 0 {
+		t.Errorf("期望 panic 转换为带调用栈的错误, 实际 %v", err)
+	}
+}
+
+func TestRecoverAndLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&buf, nil))
+
+	var recovered any
+	handler := basic.Chain(func(ctx context.Context, items []int) error {
+		panic("boom")
+	}, middleware.Logging[int](logger), middleware.Recover[int](func(ierr any) {
+		recovered = ierr
+	}))
+
+	err := handler(context.Background(), []int{1, 2})
+	var perr *basic.PanicError
+	if !errors.As(err, &perr) || recovered != "boom" {
+		t.Errorf("期望 recover, 实际 %v %v", err, recovered)
+	}
+	if out := buf.String(); !strings.Contains(out, "batch handled") || !strings.Contains(out, "items=2") {
+		t.Errorf("日志错误 %s", out)
+	}
+}
+
+type countMetrics struct {
+	basic.NopMetrics
+	mu      sync.Mutex
+	batches []int
+	panics  int
+	errs    []error
+}
+
+func (m *countMetrics) BatchExecuted(size int, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.batches = append(m.batches, size)
+	m.errs = append(m.errs, err)
+}
+
+func (m *countMetrics) Panic() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.panics++
+}
+
+func TestWithExecutor(t *testing.T) {
+	metrics := &countMetrics{}
+
+	var mu sync.Mutex
+	var values []int
+	e := periodic.NewExecuteInterval[int](func(item int) {
+		if item < 0 {
+			panic(item)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, item)
+	}).WithPeriodic(time.Millisecond).
+		WithMiddleware(middleware.Metrics[int](metrics), middleware.Recover[int](nil))
+	defer e.Close()
+
+	e.Collect(1)
+	time.Sleep(time.Millisecond * 20)
+	e.Collect(-1)
+	time.Sleep(time.Millisecond * 20)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(values, []int{1}) {
+		t.Errorf("执行错误 %v", values)
+	}
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if !reflect.DeepEqual(metrics.batches, []int{1, 1}) || metrics.panics != 0 {
+		t.Errorf("Recover 在内层时 Metrics 只看到错误, 实际 %v %d", metrics.batches, metrics.panics)
+	}
+	if stats := e.Stats(); stats.Failed != 1 {
+		t.Errorf("期望 1 个失败, 实际 %+v", stats)
+	}
+}
+
+func TestMetricsPanic(t *testing.T) {
+	metrics := &countMetrics{}
+	handler := basic.Chain(func(ctx context.Context, items []int) error {
+		panic("boom")
+	}, middleware.Metrics[int](metrics))
+
+	func() {
+		defer func() {
+			if ierr := recover(); ierr != "boom" {
+				t.Errorf("Metrics 期望继续抛出 panic, 实际 %v", ierr)
+			}
+		}()
+		handler(context.Background(), []int{1})
+	}()
+
+	var perr *basic.PanicError
+	if metrics.panics != 1 || len(metrics.errs) != 1 || !errors.As(metrics.errs[0], &perr) || len(perr.Stack) == 0 {
+		t.Errorf("期望记录带调用栈的 PanicError, 实际 %d %v", metrics.panics, metrics.errs)
+	}
+}
@@ -0,0 +1,146 @@
+package execute
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/batch/threshold"
+	"github.com/474420502/execute/triggered"
+)
+
+// ErrUnknownHandler Config.Handler 没有注册
+var ErrUnknownHandler = errors.New("handler not registered")
+
+// Handler 注册的执行函数, 逐个处理批次中的数据. 返回的错误合并为批次的错误
+type Handler[ITEM any] func(ctx context.Context, item ITEM) error
+
+// Registry 按名称注册执行函数, 根据 Config 创建执行器. 零值不可用, 使用 NewRegistry 创建
+type Registry[ITEM any] struct {
+	mu       sync.RWMutex
+	handlers map[string]Handler[ITEM]
+}
+
+func NewRegistry[ITEM any]() *Registry[ITEM] {
+	return &Registry[ITEM]{handlers: make(map[string]Handler[ITEM])}
+}
+
+// Register 注册执行函数. 名称为空, handler 为 nil 或重复注册会 panic
+func (r *Registry[ITEM]) Register(name string, handler Handler[ITEM]) *Registry[ITEM] {
+	if name == "" || handler == nil {
+		panic("execute: Register with empty name or nil handler")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.handlers[name]; ok {
+		panic(fmt.Sprintf("execute: handler %q registered twice", name))
+	}
+	r.handlers[name] = handler
+	return r
+}
+
+// Handler 按名称查找执行函数
+func (r *Registry[ITEM]) Handler(name string) (Handler[ITEM], bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	handler, ok := r.handlers[name]
+	return handler, ok
+}
+
+// Build 检查配置并创建执行器. 配置错误返回 *ConfigError 的合并, 没有错误时执行器已经开始运行
+func (r *Registry[ITEM]) Build(cfg Config) (Executor[ITEM], error) {
+	err := cfg.Validate()
+	handler, ok := r.Handler(cfg.Handler)
+	if cfg.Handler != "" && !ok {
+		err = errors.Join(err, &ConfigError{Name: cfg.Name, Field: "handler", Value: cfg.Handler, Reason: ErrUnknownHandler.Error()})
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	exec := build(cfg, handler)
+	if cfg.RateLimit > 0 {
+		if _, err := exec.Reconfigure(basic.Tuning{RateLimit: &basic.RateLimit{Rate: cfg.RateLimit, Burst: cfg.RateBurst}}); err != nil {
+			exec.Shutdown(context.Background())
+			return nil, err
+		}
+	}
+	if cfg.Capacity > 0 {
+		overflow := cfg.Overflow
+		if overflow == "" {
+			overflow = OverflowBlock
+		}
+		bounded := &boundedExecutor[ITEM]{Executor: exec, overflow: overflow}
+		bounded.capacity.Store(uint64(cfg.Capacity))
+		exec = bounded
+	}
+	return exec, nil
+}
+
+// Reconfigure 检查新的配置并应用到运行中的 exec, 用于配置热加载. 只应用 Config.Tuning 中的参数,
+// kind, handler 等的修改被忽略. 配置错误返回 *ConfigError 的合并, 执行器不支持的参数返回 *basic.TuningError
+func Reconfigure[ITEM any](exec Executor[ITEM], cfg Config) ([]basic.Change, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return exec.Reconfigure(cfg.Tuning())
+}
+
+// build 按类型创建执行器, cfg 已经检查过
+func build[ITEM any](cfg Config, handler Handler[ITEM]) Executor[ITEM] {
+	periodicity := time.Duration(cfg.Periodic)
+	ttl := time.Duration(cfg.TTL)
+	timeout := time.Duration(cfg.HandlerTimeout)
+
+	switch cfg.Kind {
+	case KindInterval:
+		e := periodic.NewExecuteIntervalContext(handler).WithName(cfg.Name).WithTTL(ttl).WithHandlerTimeout(timeout)
+		if periodicity > 0 {
+			e.WithPeriodic(periodicity)
+		}
+		return e
+
+	case KindCompensate:
+		e := periodic.NewExecuteCompensateContext(handler).WithName(cfg.Name).WithTTL(ttl).WithHandlerTimeout(timeout)
+		if periodicity > 0 {
+			e.WithPeriodic(periodicity)
+		}
+		return e
+
+	case KindConcurrent:
+		e := periodic.NewConcurrentExecuteContext(handler).WithName(cfg.Name).WithTTL(ttl).WithHandlerTimeout(timeout)
+		if periodicity > 0 {
+			e.WithPeriodic(periodicity)
+		}
+		if cfg.Concurrency > 0 {
+			e.WithConcurrent(cfg.Concurrency)
+		}
+		return e
+
+	case KindThreshold:
+		e := threshold.NewThresholdExecuteContext(handler).WithName(cfg.Name).WithHandlerTimeout(timeout)
+		if periodicity > 0 {
+			e.WithPeriodic(periodicity)
+		}
+		if cfg.BatchSize > 0 {
+			e.WithBatchSize(cfg.BatchSize)
+		}
+		if cfg.Concurrency > 0 {
+			e.WithConcurrent(cfg.Concurrency)
+		}
+		return e.AsyncExecute()
+
+	case KindEvent:
+		return triggered.RegisterExecuteContext(func(ctx context.Context, items *triggered.Items[ITEM]) error {
+			return basic.HandleItems(ctx, items.Value, handler)
+		}).WithName(cfg.Name).WithTTL(ttl).WithHandlerTimeout(timeout)
+
+	default:
+		panic("execute: unknown kind " + cfg.Kind)
+	}
+}
@@ -0,0 +1,199 @@
+package execute_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute"
+	"github.com/474420502/execute/basic"
+)
+
+func TestRegistryBuild(t *testing.T) {
+	var count atomic.Int64
+	registry := execute.NewRegistry[int]().
+		Register("count", func(ctx context.Context, item int) error {
+			count.Add(int64(item))
+			return nil
+		})
+
+	var configs []execute.Config
+	err := json.Unmarshal([]byte(`[
+		{"kind": "interval", "name": "a", "handler": "count", "periodic": "1ms", "ttl": "1m"},
+		{"kind": "compensate", "name": "b", "handler": "count", "periodic": "1ms"},
+		{"kind": "concurrent", "name": "c", "handler": "count", "periodic": "1ms", "concurrency": 2},
+		{"kind": "threshold", "name": "d", "handler": "count", "periodic": "1h", "batch_size": 5, "concurrency": 2},
+		{"kind": "event", "name": "e", "handler": "count", "capacity": 100, "overflow": "reject", "handler_timeout": "1s"}
+	]`), &configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Duration(configs[0].Periodic) != time.Millisecond || time.Duration(configs[0].TTL) != time.Minute {
+		t.Fatalf("Duration 解码错误 %+v", configs[0])
+	}
+
+	for _, cfg := range configs {
+		count.Store(0)
+		exec, err := registry.Build(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		for i := 0; i < 7; i++ {
+			exec.Submit(ctx, 1)
+		}
+		if err := exec.Shutdown(ctx); err != nil {
+			t.Error(cfg.Kind, err)
+		}
+		cancel()
+
+		if n := count.Load(); n != 7 {
+			t.Errorf("%s 期望执行 7, 实际 %d", cfg.Kind, n)
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	registry := execute.NewRegistry[int]().
+		Register("noop", func(ctx context.Context, item int) error { return nil })
+
+	cases := []struct {
+		config execute.Config
+		fields []string
+	}{
+		{execute.Config{}, []string{"handler", "kind"}},
+		{execute.Config{Kind: "batch", Handler: "noop"}, []string{"kind"}},
+		{execute.Config{Kind: "interval", Handler: "missing"}, []string{"handler"}},
+		{execute.Config{Kind: "interval", Handler: "noop", BatchSize: 10, Concurrency: 2}, []string{"batch_size", "concurrency"}},
+		{execute.Config{Kind: "event", Handler: "noop", Periodic: execute.Duration(time.Second)}, []string{"periodic"}},
+		{execute.Config{Kind: "threshold", Handler: "noop", TTL: execute.Duration(time.Second), BatchSize: -1}, []string{"batch_size", "ttl"}},
+		{execute.Config{Kind: "concurrent", Handler: "noop", Overflow: execute.OverflowDrop}, []string{"overflow"}},
+		{execute.Config{Kind: "concurrent", Handler: "noop", Capacity: 10, Overflow: "ignore"}, []string{"overflow"}},
+		{execute.Config{Kind: "compensate", Handler: "noop", Periodic: -1, HandlerTimeout: -1, Capacity: -1}, []string{"capacity", "handler_timeout", "periodic"}},
+	}
+
+	for _, c := range cases {
+		_, err := registry.Build(c.config)
+		if err == nil {
+			t.Errorf("%+v 期望错误", c.config)
+			continue
+		}
+
+		var fields []string
+		for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+			var cerr *execute.ConfigError
+			if !errors.As(e, &cerr) {
+				t.Fatalf("期望 *ConfigError, 实际 %v", e)
+			}
+			fields = append(fields, cerr.Field)
+		}
+		sort.Strings(fields)
+		if strings.Join(fields, ",") != strings.Join(c.fields, ",") {
+			t.Errorf("%+v 期望字段 %v, 实际 %v: %v", c.config, c.fields, fields, err)
+		}
+	}
+
+	_, err := registry.Build(execute.Config{Kind: "interval", Name: "orders", Handler: "noop", BatchSize: 10})
+	if want := `executor "orders": field batch_size=10: not supported by kind interval`; err == nil || err.Error() != want {
+		t.Errorf("期望 %s, 实际 %v", want, err)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	release := make(chan struct{})
+	registry := execute.NewRegistry[int]().
+		Register("block", func(ctx context.Context, item int) error {
+			<-release
+			return nil
+		})
+
+	reject, _ := registry.Build(execute.Config{Kind: "interval", Handler: "block", Periodic: execute.Duration(time.Millisecond), Capacity: 2, Overflow: execute.OverflowReject})
+	drop, _ := registry.Build(execute.Config{Kind: "interval", Handler: "block", Periodic: execute.Duration(time.Millisecond), Capacity: 2, Overflow: execute.OverflowDrop})
+	block, _ := registry.Build(execute.Config{Kind: "interval", Handler: "block", Periodic: execute.Duration(time.Millisecond), Capacity: 2})
+
+	ctx := context.Background()
+	for _, exec := range []execute.Executor[int]{reject, drop, block} {
+		exec.Submit(ctx, 1)
+		exec.Submit(ctx, 2)
+	}
+
+	if err := reject.Submit(ctx, 3); err != basic.ErrQueueFull {
+		t.Errorf("reject 期望 ErrQueueFull, 实际 %v", err)
+	}
+	if err := drop.Submit(ctx, 3); err != nil {
+		t.Errorf("drop 期望 nil, 实际 %v", err)
+	}
+	if stats := drop.Stats(); stats.Dropped != 1 || stats.Collected != 3 || stats.QueueCap != 2 {
+		t.Errorf("drop 统计错误 %+v", stats)
+	}
+	if err := block.TrySubmit(3); err != basic.ErrQueueFull {
+		t.Errorf("block TrySubmit 期望 ErrQueueFull, 实际 %v", err)
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, time.Millisecond*20)
+	defer cancel()
+	if err := block.Submit(timeout, 3); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("block 期望等待到超时, 实际 %v", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- block.Submit(ctx, 3) }()
+	close(release)
+	if err := <-done; err != nil {
+		t.Errorf("有空位后期望投递成功, 实际 %v", err)
+	}
+
+	for _, exec := range []execute.Executor[int]{reject, drop, block} {
+		exec.Shutdown(ctx)
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	registry := execute.NewRegistry[int]().
+		Register("noop", func(ctx context.Context, item int) error { return nil })
+
+	cfg := execute.Config{Kind: "concurrent", Handler: "noop", Periodic: execute.Duration(time.Millisecond), Capacity: 10}
+	exec, err := registry.Build(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exec.Shutdown(context.Background())
+
+	cfg.Concurrency = 3
+	cfg.Capacity = 20
+	cfg.RateLimit = 100
+	changes, err := execute.Reconfigure(exec, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields []string
+	for _, c := range changes {
+		fields = append(fields, c.Field)
+	}
+	sort.Strings(fields)
+	if strings.Join(fields, ",") != "capacity,concurrency,rate_limit" {
+		t.Errorf("修改错误 %v", changes)
+	}
+	if exec.Stats().QueueCap != 20 {
+		t.Errorf("容量没有生效 %+v", exec.Stats())
+	}
+
+	cfg.BatchSize = 10
+	var cerr *execute.ConfigError
+	if _, err := execute.Reconfigure(exec, cfg); !errors.As(err, &cerr) || cerr.Field != "batch_size" {
+		t.Errorf("期望 batch_size 的配置错误, 实际 %v", err)
+	}
+
+	unbounded, _ := registry.Build(execute.Config{Kind: "interval", Handler: "noop"})
+	defer unbounded.Shutdown(context.Background())
+	var terr *basic.TuningError
+	if _, err := unbounded.Reconfigure(basic.Tuning{Capacity: 10}); !errors.As(err, &terr) || terr.Field != "capacity" {
+		t.Errorf("没有设置容量的执行器期望 capacity 错误, 实际 %v", err)
+	}
+}
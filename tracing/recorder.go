@@ -0,0 +1,146 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+)
+
+type spanKey struct{}
+
+// Recorder 内存中的 basic.Tracer 实现, 记录所有结束的跨度, 用于测试和本地调试
+type Recorder struct {
+	nextID atomic.Uint64
+
+	mu    sync.Mutex
+	ended []*RecordedSpan
+}
+
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// RecordedSpan 记录的跨度
+type RecordedSpan struct {
+	Name      string
+	Context   basic.SpanContext
+	Parent    basic.SpanContext
+	Links     []basic.SpanContext
+	StartTime time.Time
+	EndTime   time.Time
+
+	recorder *Recorder
+
+	mu         sync.Mutex
+	attributes map[string]any
+	errs       []error
+	ended      bool
+}
+
+// StartSpan 开始一个跨度, ctx 中已有跨度时作为它的子跨度, 否则开始新的链路
+func (r *Recorder) StartSpan(ctx context.Context, name string) (context.Context, *RecordedSpan) {
+	span := r.newSpan(name, nil)
+	if parent, ok := r.SpanContextFromContext(ctx); ok {
+		span.Parent = parent
+		span.Context.TraceID = parent.TraceID
+	}
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// Start 实现 basic.Tracer, 开始一个关联 links 的新链路
+func (r *Recorder) Start(ctx context.Context, name string, links []basic.SpanContext) (context.Context, basic.Span) {
+	span := r.newSpan(name, links)
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// SpanContextFromContext 实现 basic.Tracer
+func (r *Recorder) SpanContextFromContext(ctx context.Context) (basic.SpanContext, bool) {
+	if ctx == nil {
+		return basic.SpanContext{}, false
+	}
+	span, ok := ctx.Value(spanKey{}).(*RecordedSpan)
+	if !ok {
+		return basic.SpanContext{}, false
+	}
+	return span.Context, true
+}
+
+// Ended 所有已经结束的跨度, 按结束顺序
+func (r *Recorder) Ended() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*RecordedSpan(nil), r.ended...)
+}
+
+// Reset 清空记录
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ended = nil
+}
+
+func (r *Recorder) newSpan(name string, links []basic.SpanContext) *RecordedSpan {
+	id := r.nextID.Add(1)
+	return &RecordedSpan{
+		Name: name,
+		Context: basic.SpanContext{
+			TraceID: fmt.Sprintf("%032x", id),
+			SpanID:  fmt.Sprintf("%016x", id),
+		},
+		Links:      append([]basic.SpanContext(nil), links...),
+		StartTime:  time.Now(),
+		recorder:   r,
+		attributes: make(map[string]any),
+	}
+}
+
+func (s *RecordedSpan) SpanContext() basic.SpanContext {
+	return s.Context
+}
+
+func (s *RecordedSpan) SetAttribute(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+func (s *RecordedSpan) RecordError(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errs = append(s.errs, err)
+}
+
+// End 结束跨度, 重复调用无效
+func (s *RecordedSpan) End() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	s.mu.Unlock()
+
+	s.recorder.mu.Lock()
+	defer s.recorder.mu.Unlock()
+	s.recorder.ended = append(s.recorder.ended, s)
+}
+
+// Attribute 读取属性
+func (s *RecordedSpan) Attribute(key string) (any, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.attributes[key]
+	return v, ok
+}
+
+// Errors 记录的错误
+func (s *RecordedSpan) Errors() []error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]error(nil), s.errs...)
+}
@@ -0,0 +1,130 @@
+package tracing_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/batch/periodic"
+	"github.com/474420502/execute/batch/threshold"
+	"github.com/474420502/execute/tracing"
+	"github.com/474420502/execute/triggered"
+)
+
+func batchSpans(rec *tracing.Recorder) []*tracing.RecordedSpan {
+	var spans []*tracing.RecordedSpan
+	for _, span := range rec.Ended() {
+		if span.Name == basic.BatchSpanName {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func TestBatchSpanLinks(t *testing.T) {
+	rec := tracing.NewRecorder()
+
+	e := periodic.NewExecuteInterval(func(item int) {}).
+		WithPeriodic(time.Millisecond).
+		WithTracer(rec)
+	defer e.Close()
+
+	ctx1, req1 := rec.StartSpan(context.Background(), "request-1")
+	ctx2, req2 := rec.StartSpan(context.Background(), "request-2")
+
+	block := make(chan struct{})
+	ev := triggered.RegisterExecute(func(items *triggered.Items[int]) {
+		<-block
+	}).WithTracer(rec)
+	defer ev.Close()
+
+	// 先阻塞, 保证后面三个数据进入同一个批次
+	ev.Notify(0)
+	time.Sleep(time.Millisecond * 10)
+	ev.NotifyContext(ctx1, 1)
+	ev.NotifyContext(ctx1, 2)
+	ev.NotifyContext(ctx2, 3)
+	close(block)
+
+	e.CollectContext(ctx2, 4)
+	time.Sleep(time.Millisecond * 50)
+
+	req1.End()
+	req2.End()
+
+	spans := batchSpans(rec)
+	if len(spans) != 3 {
+		t.Fatalf("期望 3 个批次跨度, 实际 %d", len(spans))
+	}
+
+	var found bool
+	for _, span := range spans {
+		if size, _ := span.Attribute("batch.size"); size != 3 {
+			continue
+		}
+		found = true
+		if len(span.Links) != 2 || span.Links[0] != req1.Context || span.Links[1] != req2.Context {
+			t.Errorf("批次跨度应该关联两个请求跨度, 实际 %v", span.Links)
+		}
+		if span.Context.TraceID == req1.Context.TraceID {
+			t.Error("批次跨度应该是新的链路")
+		}
+	}
+	if !found {
+		t.Error("没有找到 3 个数据的批次跨度")
+	}
+}
+
+func TestThresholdSpanLinks(t *testing.T) {
+	rec := tracing.NewRecorder()
+
+	e := threshold.NewThresholdExecute(func(i int, item int) {}).
+		WithPeriodic(time.Hour).WithBatchSize(3).WithTracer(rec)
+
+	ctx1, req1 := rec.StartSpan(context.Background(), "request-1")
+	ctx2, req2 := rec.StartSpan(context.Background(), "request-2")
+	e.CollectContext(ctx1, 1)
+	e.Submit(ctx2, 2)
+	e.Collect(3)
+	if err := e.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	req1.End()
+	req2.End()
+
+	spans := batchSpans(rec)
+	if len(spans) != 1 {
+		t.Fatalf("期望 1 个批次跨度, 实际 %d", len(spans))
+	}
+	if links := spans[0].Links; len(links) != 2 || links[0] != req1.Context || links[1] != req2.Context {
+		t.Errorf("批次跨度应该关联两个请求跨度, 实际 %v", links)
+	}
+}
+
+func TestBatchSpanError(t *testing.T) {
+	rec := tracing.NewRecorder()
+
+	e := periodic.NewExecuteInterval(func(item int) {
+		panic("boom")
+	}).WithPeriodic(time.Millisecond).WithTracer(rec)
+	defer e.Close()
+
+	ctx, req := rec.StartSpan(context.Background(), "request")
+	e.CollectContext(ctx, 1)
+	time.Sleep(time.Millisecond * 30)
+	req.End()
+
+	spans := batchSpans(rec)
+	if len(spans) != 1 {
+		t.Fatalf("期望 1 个批次跨度, 实际 %d", len(spans))
+	}
+	if errs := spans[0].Errors(); len(errs) != 1 {
+		t.Errorf("panic 应该记录到批次跨度, 实际 %v", errs)
+	}
+
+	_, sub := rec.StartSpan(ctx, "child")
+	if sub.Parent != req.Context || sub.Context.TraceID != req.Context.TraceID {
+		t.Error("子跨度应该继承父跨度的链路")
+	}
+}
@@ -0,0 +1,424 @@
+package triggered
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/utils"
+)
+
+// ErrKeyNotFound 批量加载的结果中没有该 key
+var ErrKeyNotFound = errors.New("key not found")
+
+// Cache Loader 的结果缓存
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K)
+	Clear()
+}
+
+// MapCache 并发安全的无淘汰缓存
+type MapCache[K comparable, V any] struct {
+	mu     sync.RWMutex
+	values map[K]V
+}
+
+func NewMapCache[K comparable, V any]() *MapCache[K, V] {
+	return &MapCache[K, V]{values: make(map[K]V)}
+}
+
+func (c *MapCache[K, V]) Get(key K) (V, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	v, ok := c.values[key]
+	return v, ok
+}
+
+func (c *MapCache[K, V]) Set(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] = value
+}
+
+func (c *MapCache[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.values, key)
+}
+
+func (c *MapCache[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values = make(map[K]V)
+}
+
+// Loader 请求合并加载. 多个协程 Load 的 key 在一个窗口内合并成一批, 去重后调用一次 fetchDo,
+// 结果再分发给每个等待者. 默认窗口为0, 和 EventExecute 一样只合并已经到达的请求
+type Loader[K comparable, V any] struct {
+	sub *loaderSub[K, V]
+}
+
+type loaderSub[K comparable, V any] struct {
+	wait     atomic.Int64
+	maxBatch atomic.Int64
+	cache    atomic.Pointer[Cache[K, V]]
+
+	// 批量加载函数
+	fetchDo func(ctx context.Context, keys []K) (map[K]V, error)
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu       sync.Mutex
+	closed   bool
+	inflight sync.WaitGroup // 正在投递的 Load
+
+	stopChan chan struct{}
+	stopOnce utils.OnceNoWait
+	reqChan  chan loadRequest[K, V]
+
+	monitor    basic.Monitor
+	middleware basic.MiddlewareChain[K]
+}
+
+type loadRequest[K comparable, V any] struct {
+	ctx    context.Context
+	key    K
+	future *basic.Future[V]
+}
+
+func NewLoader[K comparable, V any](fetchDo func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	ctx, cancel := context.WithCancel(context.Background())
+	loader := &Loader[K, V]{
+		sub: &loaderSub[K, V]{
+			fetchDo:  fetchDo,
+			ctx:      ctx,
+			cancel:   cancel,
+			stopChan: make(chan struct{}),
+			reqChan:  make(chan loadRequest[K, V], 1024),
+		},
+	}
+
+	loader.sub.monitor.SetKind("triggered.Loader")
+	loader.sub.monitor.SetState(basic.StateRunning)
+	go loader.sub.loopExecute()
+
+	runtime.SetFinalizer(loader, func(ll *Loader[K, V]) {
+		// 停止循环执行
+		ll.Close()
+	})
+
+	return loader
+}
+
+// WithWait 设置合并窗口, 从窗口内第一个请求开始计时
+func (l *Loader[K, V]) WithWait(wait time.Duration) *Loader[K, V] {
+	l.sub.wait.Store(int64(wait))
+	return l
+}
+
+// WithMaxBatch 每批最多的请求数, 达到后立即加载. 小于等于0不限制
+func (l *Loader[K, V]) WithMaxBatch(n int) *Loader[K, V] {
+	l.sub.maxBatch.Store(int64(n))
+	return l
+}
+
+// WithCache 设置结果缓存, 只缓存加载成功的值. nil 关闭缓存
+func (l *Loader[K, V]) WithCache(cache Cache[K, V]) *Loader[K, V] {
+	if cache == nil {
+		l.sub.cache.Store(nil)
+	} else {
+		l.sub.cache.Store(&cache)
+	}
+	return l
+}
+
+// WithMetrics 设置指标, 一次批量加载记为一个批次. 默认 basic.NopMetrics
+func (l *Loader[K, V]) WithMetrics(metrics basic.Metrics) *Loader[K, V] {
+	l.sub.monitor.SetMetrics(metrics)
+	return l
+}
+
+// WithTracer 设置链路追踪, 批量加载的跨度关联所有 Load 的 ctx 中的跨度
+func (l *Loader[K, V]) WithTracer(tracer basic.Tracer) *Loader[K, V] {
+	l.sub.monitor.SetTracer(tracer)
+	return l
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (l *Loader[K, V]) WithLogger(logger *slog.Logger) *Loader[K, V] {
+	l.sub.monitor.SetLogger(logger)
+	return l
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (l *Loader[K, V]) WithName(name string) *Loader[K, V] {
+	l.sub.monitor.SetName(name)
+	return l
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (l *Loader[K, V]) WithHooks(hooks basic.Hooks) *Loader[K, V] {
+	l.sub.monitor.SetHooks(hooks)
+	return l
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (l *Loader[K, V]) WithMiddleware(middlewares ...basic.Middleware[K]) *Loader[K, V] {
+	l.sub.middleware.Use(middlewares...)
+	return l
+}
+
+// Load 加载 key. ctx 取消时返回 ctx.Err(), 批量加载不受影响
+func (l *Loader[K, V]) Load(ctx context.Context, key K) (V, error) {
+	sub := l.sub
+	if cache := sub.cache.Load(); cache != nil {
+		if v, ok := (*cache).Get(key); ok {
+			return v, nil
+		}
+	}
+
+	req := loadRequest[K, V]{ctx: ctx, key: key, future: basic.NewFuture[V]()}
+
+	sub.mu.Lock()
+	if sub.closed {
+		sub.mu.Unlock()
+		var zero V
+		return zero, basic.ErrClosed
+	}
+	sub.inflight.Add(1)
+	sub.mu.Unlock()
+
+	select {
+	case sub.reqChan <- req:
+		sub.inflight.Done()
+		sub.monitor.Collected(1)
+		sub.monitor.QueueDepth(len(sub.reqChan))
+	case <-sub.stopChan:
+		sub.inflight.Done()
+		var zero V
+		return zero, basic.ErrClosed
+	case <-ctx.Done():
+		sub.inflight.Done()
+		var zero V
+		return zero, ctx.Err()
+	}
+
+	return req.future.Await(ctx)
+}
+
+// Clear 删除 key 的缓存
+func (l *Loader[K, V]) Clear(key K) {
+	if cache := l.sub.cache.Load(); cache != nil {
+		(*cache).Delete(key)
+	}
+}
+
+// Prime 预先设置 key 的缓存
+func (l *Loader[K, V]) Prime(key K, value V) {
+	if cache := l.sub.cache.Load(); cache != nil {
+		(*cache).Set(key, value)
+	}
+}
+
+// Stats 运行状态的快照, 队列为等待合并的请求. 数量都按请求计算, 同一个 key 的多个请求各计一次
+func (l *Loader[K, V]) Stats() basic.Stats {
+	sub := l.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = len(sub.reqChan)
+	stats.QueueCap = cap(sub.reqChan)
+	return stats
+}
+
+// Close 停止加载, 等待中的请求返回 basic.ErrClosed, 正在执行的 fetchDo 的 ctx 会被取消
+func (l *Loader[K, V]) Close() {
+	l.sub.stopOnce.Do(func() {
+		l.sub.mu.Lock()
+		l.sub.closed = true
+		l.sub.mu.Unlock()
+
+		l.sub.monitor.SetState(basic.StateClosed)
+		close(l.sub.stopChan)
+		l.sub.cancel()
+	})
+}
+
+func (sub *loaderSub[K, V]) loopExecute() {
+	for {
+		select {
+		case <-sub.stopChan:
+			// 收到停止信号，退出循环
+			sub.shutdown(nil)
+			return
+		case req := <-sub.reqChan:
+			batch := []loadRequest[K, V]{req}
+
+			var ok bool
+			if wait := time.Duration(sub.wait.Load()); wait > 0 {
+				batch, ok = sub.collectWindow(batch, wait)
+			} else {
+				batch, ok = sub.collectAvailable(batch)
+			}
+			if !ok {
+				sub.shutdown(batch)
+				return
+			}
+
+			// 加载在新协程执行, 不影响下一个窗口的合并
+			go sub.dispatch(batch)
+			if len(sub.reqChan) == 0 {
+				sub.monitor.Idle()
+			}
+		}
+	}
+}
+
+// collectWindow 在窗口内继续合并请求, 收到停止信号返回 false
+func (sub *loaderSub[K, V]) collectWindow(batch []loadRequest[K, V], wait time.Duration) ([]loadRequest[K, V], bool) {
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	for !sub.full(batch) {
+		select {
+		case req := <-sub.reqChan:
+			batch = append(batch, req)
+		case <-timer.C:
+			return batch, true
+		case <-sub.stopChan:
+			return batch, false
+		}
+	}
+	return batch, true
+}
+
+// collectAvailable 只合并已经到达的请求
+func (sub *loaderSub[K, V]) collectAvailable(batch []loadRequest[K, V]) ([]loadRequest[K, V], bool) {
+	for !sub.full(batch) {
+		select {
+		case req := <-sub.reqChan:
+			batch = append(batch, req)
+		case <-sub.stopChan:
+			return batch, false
+		default:
+			return batch, true
+		}
+	}
+	return batch, true
+}
+
+func (sub *loaderSub[K, V]) full(batch []loadRequest[K, V]) bool {
+	maxBatch := int(sub.maxBatch.Load())
+	return maxBatch > 0 && len(batch) >= maxBatch
+}
+
+// dispatch 去重后加载并把结果分发给每个等待者. 批次大小按请求计算, 和 Collected 一致
+func (sub *loaderSub[K, V]) dispatch(batch []loadRequest[K, V]) {
+	waiters := make(map[K][]*basic.Future[V], len(batch))
+	keys := make([]K, 0, len(batch))
+	ctxs := make([]context.Context, 0, len(batch))
+	for _, req := range batch {
+		ctxs = append(ctxs, req.ctx)
+		if _, ok := waiters[req.key]; !ok {
+			keys = append(keys, req.key)
+		}
+		waiters[req.key] = append(waiters[req.key], req.future)
+	}
+
+	var result loadResult[K, V]
+	err := sub.monitor.Execute(basic.ContextLinks(&sub.monitor, ctxs...), len(batch), func(ctx context.Context) error {
+		return sub.middleware.Then(func(ctx context.Context, keys []K) error {
+			// 批次的 ctx 携带跨度, 回调返回的值和超时, Close 时同样取消
+			ctx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			defer context.AfterFunc(sub.ctx, cancel)()
+
+			values, err := sub.fetchDo(ctx, keys)
+			if err == nil {
+				result.set(values)
+			}
+			return err
+		})(ctx, keys)
+	})
+	values := result.seal()
+	if err != nil {
+		values = nil
+	}
+
+	var cache Cache[K, V]
+	if c := sub.cache.Load(); c != nil {
+		cache = *c
+	}
+
+	var zero V
+	for key, futures := range waiters {
+		v, ok := values[key]
+		var kerr error
+		switch {
+		case err != nil:
+			kerr = err
+		case !ok:
+			kerr = ErrKeyNotFound
+		case cache != nil:
+			cache.Set(key, v)
+		}
+
+		for _, f := range futures {
+			if kerr != nil {
+				f.Resolve(zero, kerr)
+			} else {
+				f.Resolve(v, nil)
+			}
+		}
+	}
+}
+
+// loadResult 一次批量加载的结果. 超时被放弃的 fetchDo 可能在分发之后才返回, 分发前封存, 之后不再写入
+type loadResult[K comparable, V any] struct {
+	mu     sync.Mutex
+	values map[K]V
+	sealed bool
+}
+
+func (r *loadResult[K, V]) set(values map[K]V) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.sealed {
+		r.values = values
+	}
+}
+
+// seal 封存并返回结果
+func (r *loadResult[K, V]) seal() map[K]V {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sealed = true
+	return r.values
+}
+
+// shutdown 等待正在投递的请求, 然后全部返回关闭错误
+func (sub *loaderSub[K, V]) shutdown(batch []loadRequest[K, V]) {
+	sub.inflight.Wait()
+	for drained := false; !drained; {
+		select {
+		case req := <-sub.reqChan:
+			batch = append(batch, req)
+		default:
+			drained = true
+		}
+	}
+
+	sub.monitor.Dropped(len(batch), basic.ErrClosed)
+	sub.monitor.Shutdown()
+
+	var zero V
+	for _, req := range batch {
+		req.future.Resolve(zero, basic.ErrClosed)
+	}
+}
@@ -0,0 +1,185 @@
+package triggered
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/474420502/execute/basic"
+	"github.com/474420502/execute/middleware"
+)
+
+func TestLoaderBatchAndDedup(t *testing.T) {
+	var mu sync.Mutex
+	var calls [][]int
+
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		calls = append(calls, append([]int(nil), keys...))
+		mu.Unlock()
+
+		values := make(map[int]string, len(keys))
+		for _, key := range keys {
+			if key != 404 {
+				values[key] = fmt.Sprint("v", key)
+			}
+		}
+		return values, nil
+	}).WithWait(time.Millisecond * 20)
+	defer loader.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(key int) {
+			defer wg.Done()
+			v, err := loader.Load(context.Background(), key)
+			if err != nil || v != fmt.Sprint("v", key) {
+				t.Errorf("Load(%d) = %v, %v", key, v, err)
+			}
+		}(i % 5)
+	}
+	wg.Wait()
+
+	mu.Lock()
+	if len(calls) != 1 {
+		t.Fatalf("期望窗口内只加载一次, 实际 %v", calls)
+	}
+	keys := calls[0]
+	sort.Ints(keys)
+	if fmt.Sprint(keys) != "[0 1 2 3 4]" {
+		t.Errorf("期望去重后的 key [0 1 2 3 4], 实际 %v", keys)
+	}
+	mu.Unlock()
+
+	if _, err := loader.Load(context.Background(), 404); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("期望 ErrKeyNotFound, 实际 %v", err)
+	}
+
+	// 收集和执行都按请求计算, 全部返回后没有等待的请求
+	if stats := loader.Stats(); stats.Collected != 21 || stats.Processed != 21 {
+		t.Errorf("期望收集和执行都是 21 个请求, 实际 %+v", stats)
+	}
+}
+
+func TestLoaderCache(t *testing.T) {
+	var mu sync.Mutex
+	fetched := 0
+
+	loader := NewLoader(func(ctx context.Context, keys []string) (map[string]int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetched += len(keys)
+		if keys[0] == "bad" {
+			return nil, errors.New("fetch failed")
+		}
+		values := make(map[string]int)
+		for _, key := range keys {
+			values[key] = len(key)
+		}
+		return values, nil
+	}).WithCache(NewMapCache[string, int]())
+	defer loader.Close()
+
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if v, err := loader.Load(ctx, "abc"); err != nil || v != 3 {
+			t.Errorf("Load = %v, %v", v, err)
+		}
+	}
+	if _, err := loader.Load(ctx, "bad"); err == nil {
+		t.Error("期望加载错误")
+	}
+	if _, err := loader.Load(ctx, "bad"); err == nil {
+		t.Error("失败的结果不应该缓存")
+	}
+
+	loader.Prime("primed", 100)
+	if v, _ := loader.Load(ctx, "primed"); v != 100 {
+		t.Errorf("期望预设缓存 100, 实际 %d", v)
+	}
+	loader.Clear("abc")
+	loader.Load(ctx, "abc")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if fetched != 4 {
+		t.Errorf("期望加载 4 次, 实际 %d", fetched)
+	}
+}
+
+func TestLoaderClose(t *testing.T) {
+	block := make(chan struct{})
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		select {
+		case <-block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		return nil, nil
+	})
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := loader.Load(context.Background(), 1)
+		errs <- err
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	if _, err := loader.Load(ctx, 2); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望等待超时, 实际 %v", err)
+	}
+
+	if state := loader.Stats().State; state != basic.StateRunning {
+		t.Errorf("期望运行中, 实际 %s", state)
+	}
+	loader.Close()
+	if state := loader.Stats().State; state != basic.StateClosed {
+		t.Errorf("关闭后期望已关闭, 实际 %s", state)
+	}
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("关闭后正在加载的 ctx 应该被取消, 实际 %v", err)
+	}
+	if _, err := loader.Load(context.Background(), 3); !errors.Is(err, basic.ErrClosed) {
+		t.Errorf("关闭后期望 ErrClosed, 实际 %v", err)
+	}
+	close(block)
+}
+
+func TestLoaderBatchContext(t *testing.T) {
+	type ctxKey struct{}
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		v, _ := ctx.Value(ctxKey{}).(string)
+		return map[int]string{keys[0]: v}, nil
+	}).WithHooks(basic.Hooks{
+		OnBatchStart: func(ctx context.Context, n int) (context.Context, error) {
+			return context.WithValue(ctx, ctxKey{}, "batch"), nil
+		},
+	})
+	defer loader.Close()
+
+	if v, err := loader.Load(context.Background(), 1); err != nil || v != "batch" {
+		t.Errorf("fetchDo 期望收到批次的 ctx, 实际 %q %v", v, err)
+	}
+}
+
+func TestLoaderAbandonedFetch(t *testing.T) {
+	returned := make(chan struct{})
+	loader := NewLoader(func(ctx context.Context, keys []int) (map[int]int, error) {
+		defer close(returned)
+		time.Sleep(time.Millisecond * 20)
+		return map[int]int{keys[0]: 1}, nil
+	}).WithMiddleware(middleware.Timeout[int](time.Millisecond * 5))
+	defer loader.Close()
+
+	if _, err := loader.Load(context.Background(), 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("期望加载超时, 实际 %v", err)
+	}
+	// 被放弃的 fetchDo 在分发之后返回
+	<-returned
+}
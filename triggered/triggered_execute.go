@@ -1,10 +1,13 @@
 package triggered
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"runtime"
 	"sync"
+	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/utils"
 )
 
@@ -19,11 +22,17 @@ type eventExecuteSub[ITEM any] struct {
 	stopChan        chan struct{}
 	stopOnce        utils.OnceNoWait
 
-	itemsChan chan ITEM
+	items   *basic.Queue[basic.Entry[ITEM]]
+	gate    basic.Gate
+	expiry  basic.Expiry[ITEM]
+	batches basic.BatchPool[ITEM]
+	monitor basic.Monitor
+
+	middleware basic.MiddlewareChain[ITEM]
 
 	shared Shared
 	// 要执行的函数
-	execDo func(params *Items[ITEM])
+	execDo func(ctx context.Context, params *Items[ITEM]) error
 }
 
 type Shared struct {
@@ -60,16 +69,26 @@ func (e *EventExecute[ITEM]) WithShared(v any) *EventExecute[ITEM] {
 // RegisterExecute注册一个执行单元
 // 返回分配的事件号
 func RegisterExecute[ITEM any](execDo func(items *Items[ITEM])) *EventExecute[ITEM] {
+	return RegisterExecuteContext(func(ctx context.Context, items *Items[ITEM]) error {
+		execDo(items)
+		return nil
+	})
+}
+
+// RegisterExecuteContext 以带上下文的执行函数注册. ctx 携带批次跨度, 设置了 WithHandlerTimeout 时超时会被取消
+func RegisterExecuteContext[ITEM any](execDo func(ctx context.Context, items *Items[ITEM]) error) *EventExecute[ITEM] {
 
 	// 构造执行单元
 	exec := &EventExecute[ITEM]{
 		sub: &eventExecuteSub[ITEM]{
-			execDo:    execDo,
-			stopChan:  make(chan struct{}, 1),
-			itemsChan: make(chan ITEM, 1024),
+			execDo:   execDo,
+			stopChan: make(chan struct{}, 1),
+			items:    basic.NewQueue[basic.Entry[ITEM]](1024),
 		},
 	}
 
+	exec.sub.monitor.SetKind("triggered.EventExecute")
+	exec.sub.monitor.SetState(basic.StateRunning)
 	exec.loopExecute()
 
 	runtime.SetFinalizer(exec, func(ee *EventExecute[ITEM]) {
@@ -81,23 +100,51 @@ func RegisterExecute[ITEM any](execDo func(items *Items[ITEM])) *EventExecute[IT
 }
 
 type Config[ITEM any] struct {
-	ItemsChanSize uint64
-	ExecuteDo     func(items *Items[ITEM]) // require
+	ItemsChanSize    uint64
+	ExecuteDo        func(items *Items[ITEM])                            // 和 ExecuteContextDo 必须设置一个
+	ExecuteContextDo func(ctx context.Context, items *Items[ITEM]) error // 带上下文的执行函数, 优先于 ExecuteDo
+	TTL              time.Duration                                       // 数据存活时间, 0 不过期
+	OnExpired        func(item ITEM)                                     // 过期数据的处理函数
+	Logger           *slog.Logger                                        // 结构化日志, nil 使用 slog.Default()
+	Hooks            basic.Hooks                                         // 生命周期回调
+	HandlerTimeout   time.Duration                                       // 批次执行超时, 0 不超时
+	AbandonPolicy    basic.AbandonPolicy                                 // 执行超时后的处理策略
+	RingBufferSize   int                                                 // 大于0时使用无锁环形缓冲区代替通道, 忽略 ItemsChanSize
 }
 
 // RegisterExecute注册一个执行单元
 // 返回分配的事件号
 func RegisterExecuteEx[ITEM any](config *Config[ITEM]) *EventExecute[ITEM] {
+	execDo := config.ExecuteContextDo
+	if execDo == nil {
+		executeDo := config.ExecuteDo
+		execDo = func(ctx context.Context, items *Items[ITEM]) error {
+			executeDo(items)
+			return nil
+		}
+	}
 
 	// 构造执行单元
 	exec := &EventExecute[ITEM]{
 		sub: &eventExecuteSub[ITEM]{
-			execDo:    config.ExecuteDo,
-			stopChan:  make(chan struct{}, 1),
-			itemsChan: make(chan ITEM, config.ItemsChanSize),
+			execDo:   execDo,
+			stopChan: make(chan struct{}, 1),
+			items:    basic.NewQueue[basic.Entry[ITEM]](int(config.ItemsChanSize)),
 		},
 	}
 
+	exec.sub.expiry.SetTTL(config.TTL)
+	exec.sub.expiry.SetOnExpired(config.OnExpired)
+	exec.sub.monitor.SetLogger(config.Logger)
+	exec.sub.monitor.SetHooks(config.Hooks)
+	exec.sub.monitor.SetHandlerTimeout(config.HandlerTimeout)
+	exec.sub.monitor.SetAbandonPolicy(config.AbandonPolicy)
+	if config.RingBufferSize > 0 {
+		exec.sub.items.UseRing(config.RingBufferSize)
+	}
+
+	exec.sub.monitor.SetKind("triggered.EventExecute")
+	exec.sub.monitor.SetState(basic.StateRunning)
 	exec.loopExecute()
 
 	runtime.SetFinalizer(exec, func(ee *EventExecute[ITEM]) {
@@ -108,11 +155,119 @@ func RegisterExecuteEx[ITEM any](config *Config[ITEM]) *EventExecute[ITEM] {
 	return exec
 }
 
+// WithMetrics 设置指标, 默认 basic.NopMetrics
+func (e *EventExecute[ITEM]) WithMetrics(metrics basic.Metrics) *EventExecute[ITEM] {
+	e.sub.monitor.SetMetrics(metrics)
+	return e
+}
+
+// WithTracer 设置链路追踪, 每个批次开始一个关联所有数据跨度的批次跨度
+func (e *EventExecute[ITEM]) WithTracer(tracer basic.Tracer) *EventExecute[ITEM] {
+	e.sub.monitor.SetTracer(tracer)
+	return e
+}
+
+// WithLogger 设置结构化日志, 记录 panic, 批次开始结束, 丢弃和关闭事件. nil 使用 slog.Default()
+func (e *EventExecute[ITEM]) WithLogger(logger *slog.Logger) *EventExecute[ITEM] {
+	e.sub.monitor.SetLogger(logger)
+	return e
+}
+
+// WithName 设置执行器名称, 作为日志的 executor 属性
+func (e *EventExecute[ITEM]) WithName(name string) *EventExecute[ITEM] {
+	e.sub.monitor.SetName(name)
+	return e
+}
+
+// WithHooks 设置生命周期回调: 批次开始结束, 进入空闲和关闭
+func (e *EventExecute[ITEM]) WithHooks(hooks basic.Hooks) *EventExecute[ITEM] {
+	e.sub.monitor.SetHooks(hooks)
+	return e
+}
+
+// WithMiddleware 追加批次中间件, 第一个在最外层
+func (e *EventExecute[ITEM]) WithMiddleware(middlewares ...basic.Middleware[ITEM]) *EventExecute[ITEM] {
+	e.sub.middleware.Use(middlewares...)
+	return e
+}
+
+// WithHandlerTimeout 设置批次执行超时, 超时后取消 ctx, 批次以 basic.ErrHandlerTimeout 结束并继续执行下一个批次. 小于等于0不超时
+func (e *EventExecute[ITEM]) WithHandlerTimeout(d time.Duration) *EventExecute[ITEM] {
+	e.sub.monitor.SetHandlerTimeout(d)
+	return e
+}
+
+// WithAbandonPolicy 设置执行超时后对仍在运行的执行函数的处理策略, 默认 basic.AbandonDetach
+func (e *EventExecute[ITEM]) WithAbandonPolicy(policy basic.AbandonPolicy) *EventExecute[ITEM] {
+	e.sub.monitor.SetAbandonPolicy(policy)
+	return e
+}
+
+// WithTTL 设置数据的存活时间, 从通知时开始计算, 过期的数据在执行前被丢弃. 小于等于0不过期
+func (e *EventExecute[ITEM]) WithTTL(ttl time.Duration) *EventExecute[ITEM] {
+	e.sub.expiry.SetTTL(ttl)
+	return e
+}
+
+// WithOnExpired 设置过期数据的处理函数
+func (e *EventExecute[ITEM]) WithOnExpired(onExpiredDo func(item ITEM)) *EventExecute[ITEM] {
+	e.sub.expiry.SetOnExpired(onExpiredDo)
+	return e
+}
+
+// WithRingBuffer 使用容量不小于 size 的无锁环形缓冲区代替通道作为数据队列, 容量向上取 2 的幂.
+// 多个协程高频收集时, 执行循环每次取走全部已写入的数据, 不需要逐个接收. 只有第一次调用生效
+func (e *EventExecute[ITEM]) WithRingBuffer(size int) *EventExecute[ITEM] {
+	e.sub.items.UseRing(size)
+	return e
+}
+
+// Expired 过期丢弃的数量
+func (exec *EventExecute[ITEM]) Expired() uint64 {
+	return exec.sub.expiry.Expired()
+}
+
+// Reconfigure 修改运行中的限速. 事件执行器没有周期和批次数量, 设置了会返回 *basic.TuningError. 返回实际的修改
+func (exec *EventExecute[ITEM]) Reconfigure(t basic.Tuning) ([]basic.Change, error) {
+	changes, err := exec.sub.monitor.Reconfigure(t, 0)
+	if err != nil {
+		return nil, err
+	}
+	return exec.sub.monitor.Reconfigured(changes), nil
+}
+
+// Pause 暂停执行, 继续接收数据. 正在执行的批次执行完, 之后的批次等待到 Resume. 暂停中关闭时等待的批次被丢弃
+func (exec *EventExecute[ITEM]) Pause() {
+	exec.sub.monitor.Pause()
+}
+
+// Resume 恢复执行
+func (exec *EventExecute[ITEM]) Resume() {
+	exec.sub.monitor.Resume()
+}
+
+// Stats 运行状态的快照
+func (exec *EventExecute[ITEM]) Stats() basic.Stats {
+	sub := exec.sub
+	stats := sub.monitor.Stats()
+	stats.QueueLen = sub.items.Len()
+	stats.QueueCap = sub.items.Cap()
+	return stats
+}
+
+// Settled 下一次有数据执行完或被丢弃时关闭的通道, 用于等待队列有空位
+func (exec *EventExecute[ITEM]) Settled() <-chan struct{} {
+	return exec.sub.monitor.Settled()
+}
+
 // 关闭整个触发器
 func (exec *EventExecute[ITEM]) Close() {
 	exec.sub.stopOnce.Do(func() {
+		exec.sub.monitor.SetState(basic.StateClosed)
+		exec.sub.monitor.Shutdown()
 		close(exec.sub.stopChan)
-		close(exec.sub.itemsChan)
+		exec.sub.gate.Close()
+		exec.sub.items.Close()
 	})
 
 }
@@ -123,50 +278,72 @@ func (exec *EventExecute[ITEM]) loopExecute() {
 
 		go func() {
 
-			var items []ITEM
+			var entries []basic.Entry[ITEM]
 
 			for {
 				select {
 				case <-sub.stopChan:
-					// 收到停止信号，退出循环
+					// 收到停止信号，退出循环. 队列中剩下的数据计为丢弃
+					sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
 					return
-				case item := <-sub.itemsChan:
+				case entry, ok := <-sub.items.C():
+					if !ok {
+						// 已关闭
+						sub.monitor.Dropped(sub.items.Discard(), basic.ErrClosed)
+						return
+					}
 					// log.Println(" param := <-exec.params 1 ")
-					items = append(items, item)
-
-					func() {
-						for {
-
-							select {
-							case item := <-sub.itemsChan:
-								// log.Println(" param := <-exec.params 2 ")
-								items = append(items, item)
-							default:
-								func() {
-									if len(items) == 0 {
-										return
-									}
-									// recover保护
-									defer func() {
-										if ierr := recover(); ierr != nil {
-											log.Println(ierr)
-										}
-									}()
-
-									// 执行已注册函数
-									sub.execDo(&Items[ITEM]{
-										Shared: &sub.shared,
-										Value:  items[:],
-									})
-									items = items[:0]
-								}()
+					entries = append(entries, entry)
+				case <-sub.items.Ready():
+					// 环形缓冲区有数据, 在下面一起取出
+				}
+
+				func() {
+					for {
+
+						select {
+						case entry, ok := <-sub.items.C():
+							if !ok {
+								sub.monitor.Dropped(len(entries), basic.ErrClosed)
+								entries = entries[:0]
 								return
 							}
-						}
+							// log.Println(" param := <-exec.params 2 ")
+							entries = append(entries, entry)
+						default:
+							entries = sub.items.Drain(entries)
+							if len(entries) == 0 {
+								// 没有取到数据
+								return
+							}
+							func() {
+								if len(entries) == 0 {
+									return
+								}
+								defer func() {
+									entries = entries[:0]
+								}()
 
-					}()
+								// 丢弃过期的数据
+								live := sub.expiry.Filter(&sub.monitor, entries)
+								sub.monitor.QueueDepth(sub.items.Len())
+								if len(live) == 0 {
+									return
+								}
+								batch := sub.batches.Get()
+								batch.Items = basic.ItemsOf(live, batch.Items)
+
+								err := sub.execute(basic.SpanLinks(&sub.monitor, live), batch.Items)
+								sub.batches.Put(&sub.monitor, batch, err)
+							}()
+							if sub.items.Len() == 0 {
+								sub.monitor.Idle()
+							}
+							return
+						}
+					}
 
-				}
+				}()
 
 			}
 
@@ -174,9 +351,89 @@ func (exec *EventExecute[ITEM]) loopExecute() {
 	})
 }
 
+// execute 执行已注册函数, panic 会被 recover 并转换为 error
+func (sub *eventExecuteSub[ITEM]) execute(links []basic.SpanContext, items []ITEM) error {
+	return sub.monitor.Execute(links, len(items), func(ctx context.Context) error {
+		return sub.middleware.Then(sub.handle)(ctx, items)
+	})
+}
+
+// handle 执行已注册函数, 是中间件链的最内层
+func (sub *eventExecuteSub[ITEM]) handle(ctx context.Context, items []ITEM) error {
+	return sub.execDo(ctx, &Items[ITEM]{
+		Shared: &sub.shared,
+		Value:  items[:],
+	})
+}
+
 // Notify用于通知触发执行
 // 根据事件号查找执行单元并检查通知次数
 // 达到指定次数则触发goroutine异步执行
 func (exec *EventExecute[ITEM]) Notify(item ITEM) {
-	exec.sub.itemsChan <- item
+	exec.notify(exec.sub.expiry.Entry(item))
+}
+
+// NotifyContext 通知触发执行并携带上下文, 批次跨度会关联 ctx 中的跨度
+func (exec *EventExecute[ITEM]) NotifyContext(ctx context.Context, item ITEM) {
+	entry := exec.sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	exec.notify(entry)
+}
+
+// NotifyWithTTL 通知触发执行并指定数据的存活时间
+func (exec *EventExecute[ITEM]) NotifyWithTTL(item ITEM, ttl time.Duration) {
+	exec.NotifyWithDeadline(item, time.Now().Add(ttl))
+}
+
+// NotifyWithDeadline 通知触发执行并指定数据的过期时间
+func (exec *EventExecute[ITEM]) NotifyWithDeadline(item ITEM, deadline time.Time) {
+	exec.notify(exec.sub.expiry.EntryWithDeadline(item, deadline))
+}
+
+func (exec *EventExecute[ITEM]) notify(entry basic.Entry[ITEM]) {
+	if err := exec.sub.items.Put(entry); err != nil {
+		// 已关闭
+		return
+	}
+	exec.collected()
+}
+
+func (exec *EventExecute[ITEM]) collected() {
+	exec.sub.monitor.Collected(1)
+	exec.sub.monitor.QueueDepth(exec.sub.items.Len())
+}
+
+// Submit 通知触发执行, 队列满时等待. 已关闭返回 basic.ErrClosed, ctx 结束返回 ctx.Err(). 批次跨度会关联 ctx 中的跨度
+func (exec *EventExecute[ITEM]) Submit(ctx context.Context, item ITEM) error {
+	sub := exec.sub
+	entry := sub.expiry.Entry(item)
+	entry.Ctx = ctx
+	if err := sub.items.Send(&sub.gate, ctx, entry, sub.stopChan); err != nil {
+		return err
+	}
+	exec.collected()
+	return nil
+}
+
+// TrySubmit 通知触发执行, 队列满时返回 basic.ErrQueueFull
+func (exec *EventExecute[ITEM]) TrySubmit(item ITEM) error {
+	sub := exec.sub
+	if err := sub.items.TrySend(&sub.gate, sub.expiry.Entry(item)); err != nil {
+		return err
+	}
+	exec.collected()
+	return nil
+}
+
+// Flush 等待已通知的数据全部执行或丢弃
+func (exec *EventExecute[ITEM]) Flush(ctx context.Context) error {
+	return exec.sub.monitor.Flush(ctx, exec.sub.stopChan)
+}
+
+// Shutdown 停止接收 Submit, 等待已通知的数据执行完后关闭. ctx 结束时立即关闭并返回 ctx.Err()
+func (exec *EventExecute[ITEM]) Shutdown(ctx context.Context) error {
+	exec.sub.gate.Close()
+	err := exec.Flush(ctx)
+	exec.Close()
+	return err
 }
@@ -1,19 +1,18 @@
 package triggered
 
 import (
+	"context"
 	"log"
 	"reflect"
 	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/474420502/execute/basic"
 	"github.com/474420502/execute/utils"
 )
 
-func init() {
-	log.SetFlags(log.Llongfile)
-}
-
 func TestEventExecute(t *testing.T) {
 	var (
 		executed       int
@@ -160,3 +159,115 @@ func TestSetFinalizer(t *testing.T) {
 		t.Error("SetFinalizer Error")
 	}
 }
+
+func TestNotifyWithTTL(t *testing.T) {
+	var mu sync.Mutex
+	var values []int
+	var expired []int
+	block := make(chan struct{})
+
+	exec := RegisterExecute(func(params *Items[int]) {
+		if params.Value[0] == -1 {
+			<-block
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		values = append(values, params.Value...)
+	}).WithOnExpired(func(item int) {
+		mu.Lock()
+		defer mu.Unlock()
+		expired = append(expired, item)
+	})
+	defer exec.Close()
+
+	exec.Notify(-1)
+	time.Sleep(time.Millisecond * 10)
+
+	exec.NotifyWithTTL(1, time.Millisecond*10)
+	exec.Notify(2)
+	exec.NotifyWithDeadline(3, time.Now().Add(time.Millisecond*10))
+
+	time.Sleep(time.Millisecond * 30)
+	close(block)
+	time.Sleep(time.Millisecond * 30)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(values, []int{2}) {
+		t.Errorf("期望只执行未过期的 [2], 实际 %v", values)
+	}
+	if !reflect.DeepEqual(expired, []int{1, 3}) || exec.Expired() != 2 {
+		t.Errorf("期望过期 [1 3], 实际 %v %d", expired, exec.Expired())
+	}
+}
+
+func TestEventExecuteStats(t *testing.T) {
+	exec := RegisterExecuteEx(&Config[int]{
+		ItemsChanSize: 16,
+		ExecuteDo: func(params *Items[int]) {
+			if params.Value[0] == 0 {
+				panic("item 0")
+			}
+		},
+	})
+
+	exec.Notify(1)
+	time.Sleep(time.Millisecond * 10)
+	exec.Notify(0)
+	time.Sleep(time.Millisecond * 10)
+
+	stats := exec.Stats()
+	if stats.State != basic.StateRunning || stats.QueueCap != 16 || stats.Collected != 2 || stats.Processed != 2 || stats.Failed != 1 {
+		t.Errorf("统计错误 %+v", stats)
+	}
+	if stats.LastError == nil || stats.LastBatchSize != 1 {
+		t.Errorf("最近批次错误 %+v", stats)
+	}
+
+	exec.Close()
+	if exec.Stats().State != basic.StateClosed {
+		t.Errorf("期望已关闭, 实际 %s", exec.Stats().State)
+	}
+}
+
+func TestEventExecuteRingBuffer(t *testing.T) {
+	var mu sync.Mutex
+	var count int
+	exec := RegisterExecuteEx(&Config[int]{
+		RingBufferSize: 100,
+		ExecuteDo: func(params *Items[int]) {
+			mu.Lock()
+			defer mu.Unlock()
+			count += len(params.Value)
+		},
+	})
+	defer exec.Close()
+
+	if cap := exec.Stats().QueueCap; cap != 128 {
+		t.Errorf("期望队列容量 128, 实际 %d", cap)
+	}
+
+	var wg sync.WaitGroup
+	for p := 0; p < 4; p++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				exec.Notify(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := exec.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if count != 4000 {
+		t.Errorf("期望执行 4000 个, 实际 %d", count)
+	}
+}